@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"metronome/scheduler"
+	"metronome/util"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//	Parse options of subcommand that are placed before or after positional arguments
+func parseSubcommand(fs *flag.FlagSet, args []string) []string {
+	var positionals []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positionals
+		}
+		positionals = append(positionals, args[0])
+		args = args[1:]
+	}
+}
+
+//	Return user who executes subcommand to record in audit log
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli:" + os.Getenv("USER")
+}
+
+//	Print logs of event with logs subcommand
+//	ex. metronome logs <event-id> [--task N] [--node X] [--follow]
+func logs(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	no := fs.Int("task", -1, "Number of task in event")
+	node := fs.String("node", "", "Node name")
+	follow := fs.Bool("follow", false, "Wait for new logs until event has finished")
+	positionals := parseSubcommand(fs, args)
+	if len(positionals) != 1 {
+		return "Usage: metronome logs <event-id> [--task N] [--node X] [--follow]\n", errors.New("Event ID is required")
+	}
+
+	return "", scheduler.Logs(os.Stdout, positionals[0], *no, *node, *follow)
+}
+
+//	Delete expired event results with gc subcommand
+//	ex. metronome gc [--dry-run]
+func gc(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Print event results that would be deleted without deleting them")
+	parseSubcommand(fs, args)
+
+	return "", scheduler.CollectGarbage(os.Stdout, *dryRun)
+}
+
+//	List recent events with history subcommand
+//	ex. metronome history [--name X] [--status S] [--limit N]
+func history(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	name := fs.String("name", "", "Event name")
+	status := fs.String("status", "", "Event status(inprogress / success / error / timeout)")
+	limit := fs.Int("limit", 20, "Max number of events")
+	parseSubcommand(fs, args)
+
+	results, err := scheduler.History(*name, *status, *limit)
+	if err != nil {
+		return "", err
+	}
+	scheduler.PrintHistory(os.Stdout, results)
+	return "", nil
+}
+
+//	Show results of tasks on each node in event with status subcommand
+//	ex. metronome status <event-id>
+func status(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	detail, err := scheduler.GetEventDetail(args[0])
+	if err != nil {
+		return "", err
+	}
+	scheduler.PrintEventDetail(os.Stdout, detail)
+	return "", nil
+}
+
+//	Parameters of event that are specified by multiple options(ex. "--param key1=value1 --param key2=value2")
+type paramsValue map[string]string
+
+func (p paramsValue) String() string {
+	return ""
+}
+
+func (p paramsValue) Set(s string) error {
+	items := strings.SplitN(s, "=", 2)
+	if len(items) != 2 {
+		return errors.New(fmt.Sprintf("Parameter %s is not key=value format", s))
+	}
+	p[items[0]] = items[1]
+	return nil
+}
+
+//	Fire event with fire subcommand
+//	When --wait is specified, wait until event has finished and write report of results
+//	ex. metronome fire <event-name> [--param key=value ...] [--wait [--timeout 1h] [--report out.xml]]
+func fire(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	fs := flag.NewFlagSet("fire", flag.ExitOnError)
+	params := make(paramsValue)
+	fs.Var(params, "param", "Event parameter with key=value format")
+	wait := fs.Bool("wait", false, "Wait until event has finished")
+	timeout := fs.Duration("timeout", 0, "Max duration to wait after event has been queued or started(default: 0 = forever)")
+	report := fs.String("report", "", "Path of report that is written after event has finished(junit with .xml / json with .json)")
+	positionals := parseSubcommand(fs, args)
+	if len(positionals) != 1 {
+		return "Usage: metronome fire <event-name> [--param key=value ...] [--wait [--timeout 1h] [--report out.xml]]\n", errors.New("Event name is required")
+	}
+
+	id, err := scheduler.Fire(positionals[0], params, cliActor())
+	if err != nil {
+		return "", err
+	}
+	if !*wait && *report == "" {
+		return fmt.Sprintf("%s\n", id), nil
+	}
+
+	detail, err := scheduler.WaitEvent(id, *timeout)
+	if err != nil {
+		return "", err
+	}
+	if *report != "" {
+		if err := writeReportFile(*report, detail, scheduler.ReportFormat(*report)); err != nil {
+			return "", err
+		}
+	}
+
+	//	Exit with non-zero status when event hasn't finished successfully, skipped event isn't failure
+	s := fmt.Sprintf("Event %s(%s) has finished with %s", detail.Event.Name, id, detail.Event.Status)
+	if status := detail.Event.Status; status != "success" && status != "skip" && status != "skipped" {
+		return "", errors.New(strings.TrimSpace(s + " " + detail.Event.Error))
+	}
+	return s + "\n", nil
+}
+
+//	Write report of event with report subcommand
+//	ex. metronome report <event-id> [--format junit|json] [--output out.xml]
+func report(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	format := fs.String("format", "junit", "Format of report(junit / json)")
+	output := fs.String("output", "", "Path of report(default: STDOUT)")
+	positionals := parseSubcommand(fs, args)
+	if len(positionals) != 1 {
+		return "Usage: metronome report <event-id> [--format junit|json] [--output out.xml]\n", errors.New("Event ID is required")
+	}
+
+	detail, err := scheduler.GetEventDetail(positionals[0])
+	if err != nil {
+		return "", err
+	}
+	if *output != "" {
+		return "", writeReportFile(*output, detail, *format)
+	}
+	return "", scheduler.WriteReport(os.Stdout, detail, *format)
+}
+
+func writeReportFile(path string, detail *scheduler.EventDetail, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scheduler.WriteReport(f, detail, format)
+}
+
+//	Cancel event with cancel subcommand
+//	ex. metronome cancel <event-id>
+func cancel(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	if len(args) != 1 {
+		return "Usage: metronome cancel <event-id>\n", errors.New("Event ID is required")
+	}
+	if err := scheduler.Cancel(args[0], cliActor()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Event %s has been cancelled\n", args[0]), nil
+}
+
+//	Pause or resume scheduler over all nodes with pause / resume subcommand
+func pause(paused bool) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	if paused {
+		return "Scheduler has been paused\n", scheduler.Pause(cliActor())
+	}
+	return "Scheduler has been resumed\n", scheduler.Resume(cliActor())
+}
+
+//	Print contents of event queue and progress task queue with queue subcommand
+func queues() (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	queues, err := scheduler.GetQueues()
+	if err != nil {
+		return "", err
+	}
+
+	s := "Event queue:\n"
+	for _, e := range queues.Events {
+		s += fmt.Sprintf("  ID: %s, Name: %s\n", e.ID, e.Name)
+	}
+	s += "Progress task queue:\n"
+	for _, et := range queues.Tasks {
+		s += fmt.Sprintf("  %s\n", et.String())
+	}
+	return s, nil
+}
+
+//	Print audit log with audit subcommand
+//	ex. metronome audit [--event ID|NAME] [--action A] [--since 24h] [--limit N]
+func auditLog(args []string) (string, error) {
+	log.SetFormatter(&util.SimpleFormatter{})
+
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	event := fs.String("event", "", "Event ID or name")
+	action := fs.String("action", "", "Action(push / fire / dispatch / cancel / pause / resume)")
+	since := fs.Duration("since", 0, "Show records within specified duration(ex. 24h)")
+	limit := fs.Int("limit", 50, "Max number of records")
+	parseSubcommand(fs, args)
+
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	records, err := scheduler.Audit(*event, *action, from, *limit)
+	if err != nil {
+		return "", err
+	}
+	scheduler.PrintAudit(os.Stdout, records)
+	return "", nil
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
@@ -19,6 +21,9 @@ var (
 	//	user specified variables that can reference from task.yml with {{XXX}} format
 	UserVariables stringMapValue
 
+	//	Variables that are specified by -var, they overwrite variables.yml also on reload
+	commandLineVariables stringMapValue
+
 	//	Connection parameter for Consul server
 	Token              string
 	Hostname           string
@@ -37,6 +42,18 @@ var (
 	//	All paths of task.yml
 	Files []string
 
+	//	Ignore unknown fields of operations in task.yml instead of failing to load
+	AllowUnknownFields bool
+
+	//	Refuse to start agent when validation finds any error in task.yml, not only errors that prevent loading it
+	StrictValidation bool
+
+	//	Interval seconds of checking changes of task.yml and variables.yml to reload them, zero disables it
+	WatchInterval int
+
+	//	Fail to render {{variable}} that isn't defined instead of leaving it as it is
+	StrictVariables bool
+
 	//	Instance role
 	Role string
 
@@ -45,14 +62,41 @@ var (
 
 	//	Enable debug output and features
 	Debug bool
+
+	//	Max size of task log on each node, middle of log is truncated when exceeded
+	LogMaxSize int
+
+	//	Format of log output(text / json)
+	LogFormat string
+
+	//	Additional outputs of agent log, empty file disables file output
+	Syslog         bool
+	LogFile        string
+	LogFileMaxSize int
+	LogFileMaxAge  int
+	LogFileBackups int
+
+	//	Directory to write log of each task on this node and retention days of it, empty directory disables it
+	TaskLogDir           string
+	TaskLogRetentionDays int
+
+	//	Retention policies of event results, zero disables each policy
+	RetentionDays       int
+	RetentionCount      int
+	RetentionKeepFailed int
+	AuditRetentionDays  int
+	GCInterval          int
+
+	//	Listen address and token of HTTP API on agent, empty address disables API
+	APIAddress string
+	APIToken   string
 )
 
-func init() {
-	var files string
+//	Comma separated paths of task.yml that are specified by -files
+var files string
 
-	//	load user variables from file
-	UserVariables = loadUserVariables(VARIABLES_PATH)
-	flag.Var(&UserVariables, "var", "Specify user variables(ex. \"-var key1=value1 -var key2=value2\")")
+func init() {
+	flag.Var(&commandLineVariables, "var", "Specify user variables(ex. \"-var key1=value1 -var key2=value2\")")
 
 	//	load options from commandline parameter or file
 	flag.StringVar(&Token, "token", "", "Consul ACL token")
@@ -68,6 +112,10 @@ func init() {
 	flag.StringVar(&ServiceManager, "service-manager", "init", "Service manager(systemd / init)")
 
 	flag.StringVar(&files, "files", "", "Path list of task.yml")
+	flag.BoolVar(&AllowUnknownFields, "allow-unknown-fields", false, "Ignore unknown fields of operations in task.yml(default: false)")
+	flag.BoolVar(&StrictValidation, "strict-validation", false, "Refuse to start agent when metronome validate finds any error in task.yml(default: false)")
+	flag.BoolVar(&StrictVariables, "strict-variables", false, "Fail task when it refers undefined {{variable}}(default: false)")
+	flag.IntVar(&WatchInterval, "watch-interval", 0, "Interval seconds of checking changes of task.yml and variables.yml to reload them(default: 0 = disabled)")
 
 	flag.StringVar(&Role, "role", "", "Role names of self instance(ex. \"-role web, ap\")")
 
@@ -75,6 +123,29 @@ func init() {
 
 	flag.BoolVar(&Debug, "debug", false, "Debug mode enabled(default: false)")
 
+	flag.IntVar(&LogMaxSize, "log-max-size", 2*1024*1024, "Max bytes of task log on each node(default: 2MB)")
+	flag.StringVar(&LogFormat, "log-format", "text", "Format of log output(text / json)")
+	flag.BoolVar(&Syslog, "syslog", false, "Send agent log to local syslog(default: false)")
+	flag.StringVar(&LogFile, "log-file", "", "Path of agent log file(default: disabled)")
+	flag.IntVar(&LogFileMaxSize, "log-file-max-size", 100, "Rotate agent log file when it exceeds specified MB(default: 100)")
+	flag.IntVar(&LogFileMaxAge, "log-file-max-age", 24, "Rotate agent log file when it is older than specified hours(default: 24)")
+	flag.IntVar(&LogFileBackups, "log-file-backups", 7, "Number of rotated agent log files to keep(default: 7)")
+	flag.StringVar(&TaskLogDir, "task-log-dir", "/var/log/metronome", "Directory to write log of each task(default: /var/log/metronome)")
+	flag.IntVar(&TaskLogRetentionDays, "task-log-retention-days", 7, "Delete task log files older than specified days(default: 7, 0 = keep)")
+
+	flag.IntVar(&RetentionDays, "retention-days", 0, "Delete event results older than specified days(default: 0 = keep)")
+	flag.IntVar(&RetentionCount, "retention-count", 0, "Keep specified number of latest results for each event name(default: 0 = keep all)")
+	flag.IntVar(&RetentionKeepFailed, "retention-keep-failed", 0, "Always keep specified number of latest failed results for each event name(default: 0)")
+	flag.IntVar(&AuditRetentionDays, "audit-retention-days", 30, "Delete audit records older than specified days(default: 30, 0 = keep)")
+	flag.IntVar(&GCInterval, "gc-interval", 60, "Interval minutes of deleting event results by retention policies(default: 60)")
+
+	flag.StringVar(&APIAddress, "api-addr", "", "Listen address of HTTP API(ex. \"127.0.0.1:8600\", default: disabled)")
+	flag.StringVar(&APIToken, "api-token", "", "Token to access HTTP API(default: same as Consul ACL token)")
+}
+
+//	Load options from config.yml and command line, and user variables from variables.yml
+//	It is called by main instead of init to keep flags of test binary from being parsed
+func Load() {
 	if args, err := conflag.ArgsFrom(CONF_PATH); err == nil {
 		flag.CommandLine.Parse(args)
 	}
@@ -83,21 +154,33 @@ func init() {
 
 	Files = strings.Split(files, ",")
 
+	//	load user variables from file, and use only -var when variables.yml is broken
+	var err error
+	if UserVariables, err = LoadUserVariables(); err != nil {
+		UserVariables = commandLineVariables
+	}
+
 	setEnvironmentVariables()
 }
 
-func loadUserVariables(path string) map[string]string {
+//	Load user variables from variables.yml and overwrite them by -var
+//	Missing variables.yml isn't an error because it is optional
+func LoadUserVariables() (map[string]string, error) {
 	vars := make(map[string]string)
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil
+	b, err := ioutil.ReadFile(VARIABLES_PATH)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
-
-	if err := yaml.Unmarshal(b, &vars); err != nil {
-		return nil
+	if err == nil {
+		if err := yaml.Unmarshal(b, &vars); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to unmarshal %s(%s)", VARIABLES_PATH, err))
+		}
 	}
 
-	return vars
+	for k, v := range commandLineVariables {
+		vars[k] = v
+	}
+	return vars, nil
 }
 
 //	Create map structure when load variables automatically
@@ -157,6 +240,36 @@ func GetValue(name string) string {
 		return strconv.FormatBool(Skippable)
 	case "debug":
 		return strconv.FormatBool(Debug)
+	case "log-max-size":
+		return strconv.Itoa(LogMaxSize)
+	case "log-format":
+		return LogFormat
+	case "syslog":
+		return strconv.FormatBool(Syslog)
+	case "log-file":
+		return LogFile
+	case "log-file-max-size":
+		return strconv.Itoa(LogFileMaxSize)
+	case "log-file-max-age":
+		return strconv.Itoa(LogFileMaxAge)
+	case "log-file-backups":
+		return strconv.Itoa(LogFileBackups)
+	case "task-log-dir":
+		return TaskLogDir
+	case "task-log-retention-days":
+		return strconv.Itoa(TaskLogRetentionDays)
+	case "retention-days":
+		return strconv.Itoa(RetentionDays)
+	case "retention-count":
+		return strconv.Itoa(RetentionCount)
+	case "retention-keep-failed":
+		return strconv.Itoa(RetentionKeepFailed)
+	case "audit-retention-days":
+		return strconv.Itoa(AuditRetentionDays)
+	case "gc-interval":
+		return strconv.Itoa(GCInterval)
+	case "api-addr":
+		return APIAddress
 	}
 	return ""
 }
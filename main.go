@@ -2,6 +2,7 @@ package main
 
 import (
 	"metronome/config"
+	"metronome/scheduler"
 	"metronome/util"
 	"os"
 
@@ -9,7 +10,14 @@ import (
 )
 
 func main() {
-	log.SetFormatter(&util.LogFormatter{})
+	config.Load()
+	scheduler.AgentVersion = Version
+
+	if config.LogFormat == "json" {
+		log.SetFormatter(&util.JSONFormatter{})
+	} else {
+		log.SetFormatter(&util.LogFormatter{})
+	}
 	if config.Debug {
 		log.SetLevel(log.DebugLevel)
 	} else {
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	cases := []struct {
+		name     string
+		labels   []string
+		incs     [][]string
+		expected string
+	}{
+		{"without labels", nil, [][]string{nil, nil}, "# HELP c help\n# TYPE c counter\nc 2\n"},
+		{"no samples", []string{"name"}, nil, "# HELP c help\n# TYPE c counter\n"},
+		{"labels", []string{"name", "status"}, [][]string{{"b", "ok"}, {"a", "ok"}, {"b", "ok"}}, "# HELP c help\n# TYPE c counter\n" +
+			"c{name=\"a\",status=\"ok\"} 1\nc{name=\"b\",status=\"ok\"} 2\n"},
+		{"escape", []string{"name"}, [][]string{{"a\"b\\c\nd"}}, "# HELP c help\n# TYPE c counter\nc{name=\"a\\\"b\\\\c\\nd\"} 1\n"},
+		{"missing value", []string{"name", "status"}, [][]string{{"a"}}, "# HELP c help\n# TYPE c counter\nc{name=\"a\",status=\"\"} 1\n"},
+	}
+	for _, c := range cases {
+		counter := &Counter{name: "c", help: "help", labels: c.labels, values: make(map[string]float64)}
+		for _, values := range c.incs {
+			counter.Inc(values...)
+		}
+		var b bytes.Buffer
+		counter.Write(&b)
+		if b.String() != c.expected {
+			t.Errorf("%s: Write() = %q, want %q", c.name, b.String(), c.expected)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	cases := []struct {
+		name     string
+		values   []float64
+		expected string
+	}{
+		{"empty", nil, "# HELP h help\n# TYPE h histogram\n"},
+		{"observe", []float64{0.5, 1, 3}, "# HELP h help\n# TYPE h histogram\n" +
+			"h_bucket{type=\"x\",le=\"1\"} 2\nh_bucket{type=\"x\",le=\"2.5\"} 2\nh_bucket{type=\"x\",le=\"+Inf\"} 3\n" +
+			"h_sum{type=\"x\"} 4.5\nh_count{type=\"x\"} 3\n"},
+	}
+	for _, c := range cases {
+		h := &Histogram{name: "h", help: "help", labels: []string{"type"}, buckets: []float64{1, 2.5}, values: make(map[string]*histogramValue)}
+		for _, v := range c.values {
+			h.Observe(v, "x")
+		}
+		var b bytes.Buffer
+		h.Write(&b)
+		if b.String() != c.expected {
+			t.Errorf("%s: Write() = %q, want %q", c.name, b.String(), c.expected)
+		}
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	cases := []struct {
+		name     string
+		samples  []Sample
+		expected string
+	}{
+		{"no samples", nil, "# HELP g help\n# TYPE g gauge\n"},
+		{"samples", []Sample{{Values: []string{"event"}, Value: 3}, {Values: []string{"task"}, Value: 0.25}}, "# HELP g help\n# TYPE g gauge\n" +
+			"g{queue=\"event\"} 3\ng{queue=\"task\"} 0.25\n"},
+	}
+	for _, c := range cases {
+		samples := c.samples
+		g := &GaugeFunc{name: "g", help: "help", labels: []string{"queue"}, collect: func() []Sample { return samples }}
+		var b bytes.Buffer
+		g.Write(&b)
+		if b.String() != c.expected {
+			t.Errorf("%s: Write() = %q, want %q", c.name, b.String(), c.expected)
+		}
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-	"syscall"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
@@ -30,11 +29,19 @@ type ChefOperation struct {
 	AttributeKeys  []string `json:"attribute_keys"`
 }
 
-func NewChefOperation(v json.RawMessage) *ChefOperation {
+func NewChefOperation(v json.RawMessage) (*ChefOperation, error) {
 	o := &ChefOperation{}
-	json.Unmarshal(v, &o)
+	if err := decode(v, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
 
-	return o
+func (o *ChefOperation) Validate() error {
+	if len(o.RunList) == 0 {
+		return errors.New("run_list is required")
+	}
+	return nil
 }
 
 func (o *ChefOperation) SetDefault(m map[string]interface{}) {
@@ -49,34 +56,54 @@ func (o *ChefOperation) SetDefault(m map[string]interface{}) {
 	}
 }
 
-func (o *ChefOperation) Run(vars map[string]string) error {
+func (o *ChefOperation) Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error) {
 	//	Filter runlist by JSON file existance in roles directory
-	runlist := o.ensureRunList(o.parseRunList(o.RunList, vars))
+	runlist, err := o.parseRunList(o.RunList, vars)
+	if err != nil {
+		return nil, err
+	}
+	runlist = o.ensureRunList(runlist)
 
 	//	Create attributes JSON for chef-solo
-	json, err := o.createJson(runlist, util.ParseArray(o.AttributeKeys, vars), util.ParseMap(o.Attributes, vars))
+	keys, err := util.RenderArray(o.AttributeKeys, vars)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := util.RenderMap(o.Attributes, vars)
+	if err != nil {
+		return nil, err
+	}
+	json, err := o.createJson(runlist, keys, attributes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	//	Create configuration file for chef-solo
 	conf, err := o.createConf(vars)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	//	Execute berkshelf to get depencency cookbooks
-	if err := o.executeBerkshelf(); err != nil {
-		return err
+	if out, err := o.executeBerkshelf(logger); err != nil {
+		return out, err
 	}
 
 	//	Execute chef-solo with configuration file and attribute JSON
-	return o.executeChef(conf, json)
+	return o.executeChef(logger, conf, json)
+}
+
+func (o *ChefOperation) Describe(vars map[string]string) string {
+	runlist, err := o.parseRunList(o.RunList, vars)
+	if err != nil {
+		runlist = o.RunList
+	}
+	return "chef " + strings.Join(runlist, ",")
 }
 
 //	Convert {{role}} in task.yml to array of individual role with 'all' role
 //	When role is 'web,ap', convert from 'role[{{role}}_deploy]' to role[all_deploy], role[web_deploy] and role[ap_deploy]
-func (o *ChefOperation) parseRunList(runlist []string, vars map[string]string) []string {
+func (o *ChefOperation) parseRunList(runlist []string, vars map[string]string) ([]string, error) {
 	var results []string
 	for _, v := range runlist {
 		if strings.Contains(v, "{{role}}") {
@@ -88,7 +115,7 @@ func (o *ChefOperation) parseRunList(runlist []string, vars map[string]string) [
 			results = append(results, v)
 		}
 	}
-	return util.ParseArray(results, vars)
+	return util.RenderArray(results, vars)
 }
 
 //	Filter runlist by JSON file existance in roles directory
@@ -245,36 +272,28 @@ func (o *ChefOperation) defaultConfig() (map[string]interface{}, error) {
 	return m, nil
 }
 
-func (o *ChefOperation) executeBerkshelf() error {
+func (o *ChefOperation) executeBerkshelf(logger *log.Entry) (*CommandOutput, error) {
 	//	Check Berksfile in target pattern
 	if !util.Exists(filepath.Join(o.patternDir(), "Berksfile")) {
-		log.Debug("chef: Skip berkshelf because Berksfile doesn't found in pattern directory")
-		return nil
+		logger.Debug("chef: Skip berkshelf because Berksfile doesn't found in pattern directory")
+		return nil, nil
 	}
 
 	//	Execute berkshelf and ignore specified error
-	log.Info("chef: Execute berkshelf")
+	logger.Info("chef: Execute berkshelf")
 	cmd := exec.Command("berks", "vendor", "cookbooks")
 	cmd.Dir = o.patternDir()
-	env := os.Environ()
+	env := o.environ()
 	env = append(env, "HOME=/root")
 	cmd.Env = env
-	out, err := cmd.CombinedOutput()
-	log.Debug(string(out))
-
-	if err != nil {
-		if e2, ok := err.(*exec.ExitError); ok {
-			if s, ok := e2.Sys().(syscall.WaitStatus); ok {
-				if s.ExitStatus() == BERKS_VENDOR_ERROR {
-					return nil
-				}
-			}
-		}
+	out, err := runCommand(logger, log.DebugLevel, cmd)
+	if err != nil && util.ExitCode(err) == BERKS_VENDOR_ERROR {
+		return out, nil
 	}
-	return err
+	return out, err
 }
 
-func (o *ChefOperation) executeChef(conf string, json string) error {
+func (o *ChefOperation) executeChef(logger *log.Entry, conf string, json string) (*CommandOutput, error) {
 	//	Delete temporary files automatically without debug mode
 	if !config.Debug {
 		defer os.Remove(conf)
@@ -282,23 +301,15 @@ func (o *ChefOperation) executeChef(conf string, json string) error {
 	}
 
 	//	Execute chef with attribute JSON and configuration file
-	log.Infof("chef: Execute chef(conf: %s, json: %s)", conf, json)
+	logger.Infof("chef: Execute chef(conf: %s, json: %s)", conf, json)
 	cmd := exec.Command("chef-solo", "-c", conf, "-j", json)
 	cmd.Dir = o.patternDir()
-	env := os.Environ()
+	env := o.environ()
 	env = append(env, "HOME=/root")
 	env = append(env, "CONSUL_SECRET_KEY="+config.Token)
 	env = append(env, "ROLE="+config.Role)
 	cmd.Env = env
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Error("Chef STDOUT")
-		log.Error(string(out))
-	} else {
-		log.Debug("Chef STDOUT")
-		log.Debug(string(out))
-	}
-	return err
+	return runCommand(logger, log.InfoLevel, cmd)
 }
 
 func (o *ChefOperation) patternDir() string {
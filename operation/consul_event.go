@@ -2,6 +2,7 @@ package operation
 
 import (
 	"encoding/json"
+	"errors"
 	"metronome/config"
 	"metronome/util"
 
@@ -22,13 +23,22 @@ type ConsulEventOperation struct {
 func (o *ConsulEventOperation) SetDefault(m map[string]interface{}) {
 }
 
-func NewConsulEventOperation(v json.RawMessage) *ConsulEventOperation {
+func NewConsulEventOperation(v json.RawMessage) (*ConsulEventOperation, error) {
 	o := &ConsulEventOperation{}
-	json.Unmarshal(v, &o)
-	return o
+	if err := decode(v, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *ConsulEventOperation) Validate() error {
+	if o.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
 }
 
-func (o *ConsulEventOperation) Run(vars map[string]string) error {
+func (o *ConsulEventOperation) Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error) {
 	event := &api.UserEvent{
 		Name:          o.Name,
 		ServiceFilter: o.Filter.Service,
@@ -37,8 +47,12 @@ func (o *ConsulEventOperation) Run(vars map[string]string) error {
 	}
 
 	id, _, err := util.Consul().Event().Fire(event, &api.WriteOptions{})
-	log.Infof("consul-event: Fire %s event(ID: %s)", o.Name, id)
-	return err
+	logger.Infof("consul-event: Fire %s event(ID: %s)", o.Name, id)
+	return nil, err
+}
+
+func (o *ConsulEventOperation) Describe(vars map[string]string) string {
+	return "consul-event " + o.Name
 }
 
 func (o *ConsulEventOperation) String() string {
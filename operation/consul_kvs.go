@@ -19,50 +19,78 @@ type ConsulKVSOperation struct {
 	Name   string
 }
 
-func NewConsulKVSOperation(v json.RawMessage) *ConsulKVSOperation {
+func NewConsulKVSOperation(v json.RawMessage) (*ConsulKVSOperation, error) {
 	o := &ConsulKVSOperation{}
-	json.Unmarshal(v, &o)
-	return o
+	if err := decode(v, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *ConsulKVSOperation) Validate() error {
+	switch o.Action {
+	case "get", "put", "delete":
+	case "":
+		return errors.New("action is required")
+	default:
+		return errors.New(fmt.Sprintf("action must be get, put or delete(%s)", o.Action))
+	}
+	if o.Key == "" {
+		return errors.New("key is required")
+	}
+	if o.Action == "get" && o.Name == "" {
+		return errors.New("name is required to store value on get")
+	}
+	return nil
 }
 
 func (o *ConsulKVSOperation) SetDefault(m map[string]interface{}) {
 }
 
-func (o *ConsulKVSOperation) Run(vars map[string]string) error {
+func (o *ConsulKVSOperation) Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error) {
 	switch o.Action {
 	case "get":
-		return o.get(vars)
+		return nil, o.get(logger, vars)
 	case "put":
-		return o.put(vars)
+		return nil, o.put(logger, vars)
 	case "delete":
-		return o.delete(vars)
+		return nil, o.delete(logger, vars)
 	default:
-		return errors.New(fmt.Sprintf("Operation can't support %s action", o.Action))
+		return nil, errors.New(fmt.Sprintf("Operation can't support %s action", o.Action))
 	}
-	return nil
 }
 
-func (o *ConsulKVSOperation) get(vars map[string]string) error {
-	//	Store value that has been get to variables map
+func (o *ConsulKVSOperation) Describe(vars map[string]string) string {
+	return fmt.Sprintf("consul-kvs %s %s", o.Action, o.Key)
+}
+
+func (o *ConsulKVSOperation) get(logger *log.Entry, vars map[string]string) error {
+	//	Store value that has been get to variables map as literal that isn't rendered as template
 	kv, _, err := util.Consul().KV().Get(o.Key, &api.QueryOptions{})
-	vars[o.Name] = string(kv.Value)
-	log.Infof("Get %s from %s and store to %s", kv.Value, kv.Key, o.Name)
-	return err
+	if err != nil {
+		return err
+	}
+	if kv == nil {
+		return errors.New(fmt.Sprintf("Key %s does not found in consul KVS", o.Key))
+	}
+	vars[o.Name] = util.Literal(string(kv.Value))
+	logger.Infof("Get %s from %s and store to %s", kv.Value, kv.Key, o.Name)
+	return nil
 }
 
-func (o *ConsulKVSOperation) put(vars map[string]string) error {
+func (o *ConsulKVSOperation) put(logger *log.Entry, vars map[string]string) error {
 	kv := &api.KVPair{
 		Key:   o.Key,
 		Value: []byte(o.Value),
 	}
 	_, err := util.Consul().KV().Put(kv, &api.WriteOptions{})
-	log.Infof("Put %s to %s", o.Value, o.Key)
+	logger.Infof("Put %s to %s", o.Value, o.Key)
 	return err
 }
 
-func (o *ConsulKVSOperation) delete(vars map[string]string) error {
+func (o *ConsulKVSOperation) delete(logger *log.Entry, vars map[string]string) error {
 	_, err := util.Consul().KV().Delete(o.Key, &api.WriteOptions{})
-	log.Infof("Delete %s", o.Key)
+	logger.Infof("Delete %s", o.Key)
 	return err
 }
 
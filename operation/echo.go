@@ -2,6 +2,7 @@ package operation
 
 import (
 	"encoding/json"
+	"errors"
 	"metronome/util"
 
 	log "github.com/Sirupsen/logrus"
@@ -13,18 +14,32 @@ type EchoOperation struct {
 	message string
 }
 
-func NewEchoOperation(v json.RawMessage) *EchoOperation {
+func NewEchoOperation(v json.RawMessage) (*EchoOperation, error) {
 	o := &EchoOperation{}
-	json.Unmarshal(v, &o.message)
-	return o
+	if err := decode(v, &o.message); err != nil {
+		return nil, errors.New("message must be string")
+	}
+	return o, nil
+}
+
+func (o *EchoOperation) Validate() error {
+	return nil
 }
 
 func (o *EchoOperation) SetDefault(m map[string]interface{}) {
 }
 
-func (o *EchoOperation) Run(vars map[string]string) error {
-	log.Info("echo: " + util.ParseString(o.message, vars))
-	return nil
+func (o *EchoOperation) Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error) {
+	message, err := util.Render(o.message, vars)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("echo: " + message)
+	return nil, nil
+}
+
+func (o *EchoOperation) Describe(vars map[string]string) string {
+	return "echo " + util.ParseString(o.message, vars)
 }
 
 func (o *EchoOperation) String() string {
@@ -2,6 +2,7 @@ package operation
 
 import (
 	"encoding/json"
+	"errors"
 	"metronome/util"
 	"os/exec"
 	"path/filepath"
@@ -19,37 +20,60 @@ type ExecuteOperation struct {
 	Output    bool
 }
 
-func NewExecuteOperation(v json.RawMessage) *ExecuteOperation {
+func NewExecuteOperation(v json.RawMessage) (*ExecuteOperation, error) {
 	o := &ExecuteOperation{}
 	o.Output = true
-	json.Unmarshal(v, &o)
-	return o
+	if err := decode(v, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+//	Either file or script is required
+func (o *ExecuteOperation) Validate() error {
+	if o.File == "" && o.Script == "" {
+		return errors.New("file or script is required")
+	}
+	return nil
 }
 
 func (o *ExecuteOperation) SetDefault(m map[string]interface{}) {
 }
 
-func (o *ExecuteOperation) Run(vars map[string]string) error {
+func (o *ExecuteOperation) Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error) {
 	cmd := &exec.Cmd{}
 	cmd.Dir = filepath.Dir(o.path)
+	cmd.Env = o.environ()
 	if o.File != "" {
 		//	Execute target file with arguuments
-		file := util.ParseString(o.File, vars)
+		file, err := util.Render(o.File, vars)
+		if err != nil {
+			return nil, err
+		}
 		cmd.Path = file
 		cmd.Args = append([]string{file}, o.Arguments...)
 	} else {
 		//	Execute script in the shell
 		cmd.Path = "/bin/sh"
-		s := util.ParseString(o.Script, vars)
+		s, err := util.Render(o.Script, vars)
+		if err != nil {
+			return nil, err
+		}
 		cmd.Stdin = strings.NewReader(s)
 	}
-	out, err := cmd.CombinedOutput()
-
 	//	Output STDOUT if output flag in task.yml is true
+	level := log.DebugLevel
 	if o.Output {
-		log.Info(string(out))
+		level = log.InfoLevel
+	}
+	return runCommand(logger, level, cmd)
+}
+
+func (o *ExecuteOperation) Describe(vars map[string]string) string {
+	if o.File != "" {
+		return strings.Join(append([]string{"execute", util.ParseString(o.File, vars)}, o.Arguments...), " ")
 	}
-	return err
+	return "execute script"
 }
 
 func (o *ExecuteOperation) String() string {
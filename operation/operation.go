@@ -1,19 +1,126 @@
 package operation
 
+import (
+	"bytes"
+	"os"
+	"os/exec"
+
+	log "github.com/Sirupsen/logrus"
+)
+
 //	Extract common parameters and method from each operation
 type Operation interface {
 	String() string
 	SetPattern(path string, pattern string)
+	SetEnvironments(env []string)
+	SetType(kind string)
+	Type() string
 	SetDefault(m map[string]interface{})
-	Run(vars map[string]string) error
+	Condition() string
+	Validate() error
+	Describe(vars map[string]string) string
+	Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error)
+}
+
+//	Output of command that has been executed by operation
+type CommandOutput struct {
+	Stdout string
+	Stderr string
+}
+
+func (o *CommandOutput) String() string {
+	return o.Stdout + o.Stderr
+}
+
+//	Execute command and capture STDOUT and STDERR separately
+//	Each line is also written to logger as soon as command outputs it to show progress of long running command
+func runCommand(logger *log.Entry, level log.Level, cmd *exec.Cmd) (*CommandOutput, error) {
+	stdout := &lineWriter{logger: logger, level: level}
+	stderr := &lineWriter{logger: logger, level: level}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	return &CommandOutput{Stdout: stdout.output.String(), Stderr: stderr.output.String()}, err
+}
+
+//	Writer that captures output of command and writes each complete line to logger
+type lineWriter struct {
+	logger *log.Entry
+	level  log.Level
+	output bytes.Buffer
+	line   []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.output.Write(p)
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(string(w.line[:i]))
+		w.line = w.line[i+1:]
+	}
+	return len(p), nil
+}
+
+//	Write last line that doesn't end with newline
+func (w *lineWriter) Flush() {
+	if len(w.line) > 0 {
+		w.log(string(w.line))
+		w.line = nil
+	}
+}
+
+func (w *lineWriter) log(line string) {
+	switch w.level {
+	case log.ErrorLevel:
+		w.logger.Error(line)
+	case log.WarnLevel:
+		w.logger.Warn(line)
+	case log.InfoLevel:
+		w.logger.Info(line)
+	default:
+		w.logger.Debug(line)
+	}
 }
 
 type BaseOperation struct {
-	path    string
-	pattern string
+	path         string
+	pattern      string
+	kind         string
+	environments []string
+	When         string `json:"when"`
 }
 
 func (o *BaseOperation) SetPattern(path string, pattern string) {
 	o.path = path
 	o.pattern = pattern
 }
+
+//	Set environment variables(KEY=value) that are passed to commands in addition to those of agent
+func (o *BaseOperation) SetEnvironments(env []string) {
+	o.environments = env
+}
+
+//	Return environment variables of command that is executed by operation
+func (o *BaseOperation) environ() []string {
+	return append(os.Environ(), o.environments...)
+}
+
+//	Return conditional expression that is specified by when attribute
+func (o *BaseOperation) Condition() string {
+	return o.When
+}
+
+//	Type is key of operation in task.yml such as execute, chef
+func (o *BaseOperation) SetType(kind string) {
+	o.kind = kind
+}
+
+func (o *BaseOperation) Type() string {
+	return o.kind
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"metronome/config"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 type OperationFactory func(json.RawMessage) (Operation, error)
@@ -13,22 +17,46 @@ var Operations map[string]OperationFactory
 func init() {
 	Operations = map[string]OperationFactory{
 		"chef": func(v json.RawMessage) (Operation, error) {
-			return NewChefOperation(v), nil
+			o, err := NewChefOperation(v)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
 		},
 		"echo": func(v json.RawMessage) (Operation, error) {
-			return NewEchoOperation(v), nil
+			o, err := NewEchoOperation(v)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
 		},
 		"service": func(v json.RawMessage) (Operation, error) {
-			return NewServiceOperation(v), nil
+			o, err := NewServiceOperation(v)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
 		},
 		"execute": func(v json.RawMessage) (Operation, error) {
-			return NewExecuteOperation(v), nil
+			o, err := NewExecuteOperation(v)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
 		},
 		"consul-kvs": func(v json.RawMessage) (Operation, error) {
-			return NewConsulKVSOperation(v), nil
+			o, err := NewConsulKVSOperation(v)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
 		},
 		"consul-event": func(v json.RawMessage) (Operation, error) {
-			return NewConsulEventOperation(v), nil
+			o, err := NewConsulEventOperation(v)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
 		},
 	}
 }
@@ -41,24 +69,141 @@ func UnmarshalOperations(d []byte, operations *[]Operation) error {
 		return err
 	}
 
-	for _, m := range list {
+	for i, m := range list {
 		if len(m) != 1 {
-			return errors.New("Operation has multiple types")
+			return errors.New(fmt.Sprintf("operations[%d] has multiple types", i))
 		}
 
 		for k, v := range m {
-			//	Create operation via factory
+			//	Create operation via factory and check required fields
 			factory, ok := Operations[k]
 			if !ok {
-				return errors.New(fmt.Sprintf("Operation %s is not defined", k))
+				return errors.New(fmt.Sprintf("operations[%d]: Operation %s is not defined", i, k))
 			}
 			o, err := factory(v)
 			if err != nil {
-				return err
+				return errors.New(fmt.Sprintf("operations[%d](%s): %s", i, k, err))
 			}
+			if err := o.Validate(); err != nil {
+				return errors.New(fmt.Sprintf("operations[%d](%s): %s", i, k, err))
+			}
+			o.SetType(k)
 			result = append(result, o)
 		}
 	}
 	*operations = result
 	return nil
 }
+
+//	Decode operation and reject unknown or badly typed fields with the name of field
+//	Unknown fields are ignored when -allow-unknown-fields is specified
+func decode(v json.RawMessage, o interface{}) error {
+	for _, err := range fieldErrors(v, reflect.TypeOf(o).Elem()) {
+		if err.Unknown && config.AllowUnknownFields {
+			continue
+		}
+		return err
+	}
+	return json.Unmarshal(v, o)
+}
+
+//	Field of operation in task.yml that is unknown or can't be decoded to type of field
+type FieldError struct {
+	Field   string
+	Reason  string
+	Unknown bool
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Reason)
+}
+
+//	Return fields of operation that are unknown or can't be decoded to type of field
+func CheckFields(kind string, v json.RawMessage) []*FieldError {
+	factory, ok := Operations[kind]
+	if !ok {
+		return nil
+	}
+	o, err := factory(json.RawMessage("{}"))
+	if err != nil {
+		return nil
+	}
+	return fieldErrors(v, reflect.TypeOf(o).Elem())
+}
+
+//	Fields are matched to struct in case insensitive like encoding/json
+//	Operation that isn't object(ex. echo) has no field
+func fieldErrors(v json.RawMessage, t reflect.Type) []*FieldError {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(v, &m); err != nil {
+		return nil
+	}
+	fields := make(map[string]reflect.Type)
+	collectFields(t, fields)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []*FieldError
+	for _, k := range keys {
+		ft, found := fields[strings.ToLower(k)]
+		if !found {
+			errs = append(errs, &FieldError{Field: k, Reason: "is unknown field", Unknown: true})
+			continue
+		}
+		if err := json.Unmarshal(m[k], reflect.New(ft).Interface()); err != nil {
+			errs = append(errs, &FieldError{Field: k, Reason: "must be " + typeName(ft)})
+		}
+	}
+	return errs
+}
+
+//	Collect JSON field names including fields in embedded struct such as BaseOperation
+func collectFields(t reflect.Type, fields map[string]reflect.Type) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			collectFields(f.Type, fields)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list of " + typeName(t.Elem())
+	case reflect.Map, reflect.Struct:
+		return "map"
+	default:
+		return t.String()
+	}
+}
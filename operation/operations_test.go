@@ -0,0 +1,146 @@
+package operation
+
+import (
+	"encoding/json"
+	"metronome/config"
+	"metronome/util"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestCheckFields(t *testing.T) {
+	cases := []struct {
+		kind     string
+		src      string
+		expected []string
+	}{
+		{"execute", `{"file": "run.sh", "arguments": ["a"], "output": false}`, nil},
+		{"execute", `{"File": "run.sh", "SCRIPT": "echo"}`, nil},
+		{"execute", `{"file": "run.sh", "args": ["a"]}`, []string{"args is unknown field"}},
+		{"execute", `{"file": 1, "arguments": "a", "output": "yes"}`, []string{"arguments must be list of string", "file must be string", "output must be boolean"}},
+		{"service", `{"name": "nginx", "action": "restart", "when": "x"}`, nil},
+		{"consul-kvs", `{"action": "put", "key": "k", "value": {"a": 1}}`, []string{"value must be string"}},
+		{"echo", `"message"`, nil},
+		{"unknown", `{"a": 1}`, nil},
+	}
+	for _, c := range cases {
+		var actual []string
+		for _, err := range CheckFields(c.kind, json.RawMessage(c.src)) {
+			actual = append(actual, err.Error())
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("CheckFields(%s, %s) = %v, want %v", c.kind, c.src, actual, c.expected)
+		}
+	}
+}
+
+func TestUnmarshalOperations(t *testing.T) {
+	cases := []struct {
+		src          string
+		allowUnknown bool
+		types        []string
+		err          string
+	}{
+		{`[{"execute": {"script": "echo"}}, {"service": {"name": "nginx", "action": "start"}}]`, false, []string{"execute", "service"}, ""},
+		{`[]`, false, nil, ""},
+		{`[{"execute": {"script": "echo", "unknown": 1}}]`, false, nil, "operations[0](execute): unknown is unknown field"},
+		{`[{"execute": {"script": "echo", "unknown": 1}}]`, true, []string{"execute"}, ""},
+		{`[{"execute": {"script": 1}}]`, true, nil, "operations[0](execute): script must be string"},
+		{`[{"execute": {}}]`, false, nil, "operations[0](execute): file or script is required"},
+		{`[{"service": {"name": "nginx"}}]`, false, nil, "operations[0](service): action is required"},
+		{`[{"unknown": {}}]`, false, nil, "operations[0]: Operation unknown is not defined"},
+		{`[{"execute": {"script": "a"}, "service": {}}]`, false, nil, "operations[0] has multiple types"},
+	}
+	defer func() { config.AllowUnknownFields = false }()
+	for _, c := range cases {
+		config.AllowUnknownFields = c.allowUnknown
+		var operations []Operation
+		err := UnmarshalOperations([]byte(c.src), &operations)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("UnmarshalOperations(%s) returns error %v, want %s", c.src, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("UnmarshalOperations(%s) returns error: %s", c.src, err)
+			continue
+		}
+		var types []string
+		for _, o := range operations {
+			types = append(types, o.String())
+		}
+		if !reflect.DeepEqual(types, c.types) {
+			t.Errorf("UnmarshalOperations(%s) = %v, want %v", c.src, types, c.types)
+		}
+	}
+}
+
+func TestExecuteEnvironments(t *testing.T) {
+	o := &ExecuteOperation{Script: "echo $METRONOME_TEST_ENV"}
+	o.SetPattern("/tmp/task.yml", "app")
+	o.SetEnvironments([]string{"METRONOME_TEST_ENV=value"})
+	out, err := o.Run(log.NewEntry(log.New()), nil)
+	if err != nil {
+		t.Fatalf("Run() returns error: %s", err)
+	}
+	if out.Stdout != "value\n" {
+		t.Errorf("Command gets environment %q, want %q", out.Stdout, "value\n")
+	}
+	if v := os.Getenv("METRONOME_TEST_ENV"); v != "" {
+		t.Errorf("Environment of process is changed to %q", v)
+	}
+}
+
+var testConsulOnce sync.Once
+
+//	Serve consul KVS that has only app/version, util.Consul connects to it once in all tests of this package
+func startTestConsul() {
+	testConsulOnce.Do(func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/kv/app/version" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`[{"Key": "app/version", "Value": "MS4w"}]`))
+		}))
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		config.Hostname = host
+		config.Port, _ = strconv.Atoi(port)
+		config.Protocol = "http"
+		util.Consul()
+	})
+}
+
+func TestConsulKVSGet(t *testing.T) {
+	startTestConsul()
+
+	cases := []struct {
+		key      string
+		expected string
+		err      bool
+	}{
+		{"app/version", "1.0", false},
+		{"app/missing", "", true},
+	}
+	for _, c := range cases {
+		o := &ConsulKVSOperation{Action: "get", Key: c.key, Name: "version"}
+		vars := make(map[string]string)
+		_, err := o.Run(log.NewEntry(log.New()), vars)
+		if (err != nil) != c.err {
+			t.Errorf("%s: Run() returns error %v, want error %v", c.key, err, c.err)
+		}
+		if actual, _ := util.Render(vars["version"], nil); actual != c.expected {
+			t.Errorf("%s: Run() stores %q, want %q", c.key, actual, c.expected)
+		}
+	}
+}
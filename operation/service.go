@@ -18,18 +18,36 @@ type ServiceOperation struct {
 	Action string
 }
 
-func NewServiceOperation(v json.RawMessage) *ServiceOperation {
+func NewServiceOperation(v json.RawMessage) (*ServiceOperation, error) {
 	o := &ServiceOperation{}
-	json.Unmarshal(v, o)
-	return o
+	if err := decode(v, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *ServiceOperation) Validate() error {
+	if o.Name == "" {
+		return errors.New("name is required")
+	}
+	if o.Action == "" {
+		return errors.New("action is required")
+	}
+	return nil
 }
 
 func (o *ServiceOperation) SetDefault(m map[string]interface{}) {
 }
 
-func (o *ServiceOperation) Run(vars map[string]string) error {
-	name := util.ParseString(o.Name, vars)
-	action := util.ParseString(o.Action, vars)
+func (o *ServiceOperation) Run(logger *log.Entry, vars map[string]string) (*CommandOutput, error) {
+	name, err := util.Render(o.Name, vars)
+	if err != nil {
+		return nil, err
+	}
+	action, err := util.Render(o.Action, vars)
+	if err != nil {
+		return nil, err
+	}
 
 	//	Switch method from service manager(SystemV init/systemd)
 	var cmd *exec.Cmd
@@ -39,12 +57,15 @@ func (o *ServiceOperation) Run(vars map[string]string) error {
 	case "systemd":
 		cmd = exec.Command("/sbin/systemctl", action, name)
 	default:
-		return errors.New(fmt.Sprintf("Unknown service manager(%s)", config.ServiceManager))
+		return nil, errors.New(fmt.Sprintf("Unknown service manager(%s)", config.ServiceManager))
 	}
+	cmd.Env = o.environ()
+
+	return runCommand(logger, log.DebugLevel, cmd)
+}
 
-	out, err := cmd.CombinedOutput()
-	log.Debug(string(out))
-	return err
+func (o *ServiceOperation) Describe(vars map[string]string) string {
+	return fmt.Sprintf("service %s %s", util.ParseString(o.Name, vars), util.ParseString(o.Action, vars))
 }
 
 func (o *ServiceOperation) String() string {
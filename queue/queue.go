@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"math/rand"
+	"metronome/metrics"
 	"reflect"
 	"time"
 
@@ -15,6 +16,8 @@ var (
 	ErrUpdatedFromOther = errors.New("Failed to write by race condition, will wait and retry")
 )
 
+var casConflicts = metrics.NewCounter("metronome_queue_cas_conflicts_total", "Number of retries by conflict of CAS on queue.", "queue")
+
 type Queue struct {
 	Client *api.Client
 	Key    string
@@ -33,6 +36,7 @@ func (q *Queue) EnQueue(item interface{}) error {
 		}
 
 		log.Warn(ErrUpdatedFromOther)
+		casConflicts.Inc(q.Key)
 		time.Sleep(time.Duration(rand.Intn(1000)+1000) * time.Millisecond)
 	}
 }
@@ -46,6 +50,21 @@ func (q *Queue) DeQueue(item interface{}) (error, bool) {
 		}
 
 		log.Warn(ErrUpdatedFromOther)
+		casConflicts.Inc(q.Key)
+		time.Sleep(time.Duration(rand.Intn(1000)+1000) * time.Millisecond)
+	}
+}
+
+//	Remove all items that match the condition from the queue
+//	If conflict other process, wait random interval and retry it
+func (q *Queue) Remove(match func(item json.RawMessage) bool) (int, error) {
+	for {
+		if n, err := q.remove(match); err != ErrUpdatedFromOther {
+			return n, err
+		}
+
+		log.Warn(ErrUpdatedFromOther)
+		casConflicts.Inc(q.Key)
 		time.Sleep(time.Duration(rand.Intn(1000)+1000) * time.Millisecond)
 	}
 }
@@ -123,6 +142,41 @@ func (q *Queue) deQueue(item interface{}) (error, bool) {
 	return nil, true
 }
 
+func (q *Queue) remove(match func(item json.RawMessage) bool) (int, error) {
+	var items []json.RawMessage
+
+	//	Get current items from consul KVS
+	entry, _, err := q.Client.KV().Get(q.Key, nil)
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil || len(entry.Value) == 0 {
+		return 0, nil
+	}
+	if err := json.Unmarshal(entry.Value, &items); err != nil {
+		return 0, err
+	}
+
+	//	Store items that doesn't match the condition to consul KVS
+	rest := []json.RawMessage{}
+	for _, item := range items {
+		if !match(item) {
+			rest = append(rest, item)
+		}
+	}
+	if len(rest) == len(items) {
+		return 0, nil
+	}
+	entry.Value, err = json.Marshal(rest)
+	if err != nil {
+		return 0, err
+	}
+	if result, _, _ := q.Client.KV().CAS(entry, nil); !result {
+		return 0, ErrUpdatedFromOther
+	}
+	return len(items) - len(rest), nil
+}
+
 //	Get first item from the queue without removing it
 func (q *Queue) FetchHead(item interface{}) error {
 	var items []interface{}
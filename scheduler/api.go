@@ -0,0 +1,458 @@
+package scheduler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metronome/config"
+	"metronome/metrics"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const API_TOKEN_HEADER = "X-Metronome-Token"
+
+//	HTTP API on agent that shares implementation with subcommands
+type apiServer struct {
+	scheduler *Scheduler
+	token     string
+}
+
+type scheduleSummary struct {
+	Pattern string
+	Path    string
+	Events  []string
+	Tasks   []string
+}
+
+//	Schedule without variables, environments and notifications because they may have secrets
+type scheduleDetail struct {
+	Pattern string
+	Path    string
+	Events  []eventDetail
+	Tasks   []taskDetail
+}
+
+type eventDetail struct {
+	Name     string
+	Priority int
+	Tasks    []string
+}
+
+type taskDetail struct {
+	Name       string
+	Operations []string
+}
+
+type nodeTaskResultDetail struct {
+	Result *NodeTaskResult
+	Log    string
+}
+
+//	Start serving HTTP API on specified address in background
+//	It refuses to start without token unless address is loopback only, because API can fire and cancel events
+func (s *Scheduler) ServeAPI(addr string) error {
+	server := &apiServer{
+		scheduler: s,
+		token:     config.APIToken,
+	}
+	if server.token == "" {
+		server.token = config.Token
+	}
+	if server.token == "" && !isLoopback(addr) {
+		return errors.New(fmt.Sprintf("HTTP API on %s requires -api-token or -token unless it listens on loopback address", addr))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/schedules", server.auth(server.schedules))
+	mux.HandleFunc("/v1/schedules/", server.auth(server.schedule))
+	mux.HandleFunc("/v1/events/", server.auth(server.fire))
+	mux.HandleFunc("/v1/queues", server.auth(server.queues))
+	mux.HandleFunc("/v1/results", server.auth(server.history))
+	mux.HandleFunc("/v1/results/", server.auth(server.results))
+	mux.HandleFunc("/v1/summary/", server.auth(server.summary))
+	mux.HandleFunc("/v1/cancel/", server.auth(server.cancel))
+	mux.HandleFunc("/v1/pause", server.auth(server.pause))
+	mux.HandleFunc("/v1/logs/", server.auth(server.logs))
+	mux.HandleFunc("/v1/audit", server.auth(server.audit))
+	mux.HandleFunc("/metrics", server.authUnlessLoopback(addr, metrics.Handler))
+	mux.HandleFunc("/", server.authUnlessLoopback(addr, server.dashboard))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("Serve HTTP API on %s", addr)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Errorf("Failed to serve HTTP API(%s)", err)
+		}
+	}()
+	return nil
+}
+
+//	Return true when address listens only on loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//	Reject request that doesn't have API token in header
+//	Token isn't accepted in query to keep it from being leaked by links and access logs
+func (a *apiServer) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			writeError(w, http.StatusUnauthorized, errors.New("Token is invalid"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+//	Reject request to dashboard and metrics without token unless API listens on loopback address
+//	Browser and Prometheus can't send token in header, so they send it as password of basic authentication
+func (a *apiServer) authUnlessLoopback(addr string, h http.HandlerFunc) http.HandlerFunc {
+	if isLoopback(addr) {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metronome"`)
+			writeError(w, http.StatusUnauthorized, errors.New("Token is invalid"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+//	Return true when request has API token in header or as password of basic authentication
+func (a *apiServer) authorized(r *http.Request) bool {
+	if a.token == "" {
+		return true
+	}
+	token := r.Header.Get(API_TOKEN_HEADER)
+	if token == "" {
+		_, token, _ = r.BasicAuth()
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+//	GET /v1/schedules: List loaded schedules
+func (a *apiServer) schedules(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	var summaries []scheduleSummary
+	for pattern, s := range a.scheduler.current() {
+		summary := scheduleSummary{Pattern: pattern, Path: s.path}
+		for k := range s.Events {
+			summary.Events = append(summary.Events, k)
+		}
+		for k := range s.Tasks {
+			summary.Tasks = append(summary.Tasks, k)
+		}
+		sort.Strings(summary.Events)
+		sort.Strings(summary.Tasks)
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, summaries)
+}
+
+//	GET /v1/schedules/<pattern>: Describe events and tasks in schedule
+func (a *apiServer) schedule(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	pattern := strings.TrimPrefix(r.URL.Path, "/v1/schedules/")
+	s, found := a.scheduler.current()[pattern]
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("Pattern %s is not found", pattern)))
+		return
+	}
+	writeJSON(w, newScheduleDetail(pattern, s))
+}
+
+//	Describe schedule only by names of events and tasks and types of operations
+func newScheduleDetail(pattern string, s Schedule) scheduleDetail {
+	detail := scheduleDetail{Pattern: pattern, Path: s.path}
+
+	var events []string
+	for k := range s.Events {
+		events = append(events, k)
+	}
+	sort.Strings(events)
+	for _, k := range events {
+		e := s.Events[k]
+		event := eventDetail{Name: k, Priority: e.Priority}
+		if e.Task != "" {
+			event.Tasks = []string{e.Task}
+		}
+		for _, et := range e.OrderedTasks {
+			event.Tasks = append(event.Tasks, et.Task)
+		}
+		detail.Events = append(detail.Events, event)
+	}
+
+	var tasks []string
+	for k := range s.Tasks {
+		tasks = append(tasks, k)
+	}
+	sort.Strings(tasks)
+	for _, k := range tasks {
+		task := taskDetail{Name: k}
+		for _, o := range s.Tasks[k].Operations {
+			task.Operations = append(task.Operations, o.Type())
+		}
+		detail.Tasks = append(detail.Tasks, task)
+	}
+	return detail
+}
+
+//	POST /v1/events/<name>: Fire event with parameters in body({"params": {"key": "value"}})
+func (a *apiServer) fire(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "POST", "PUT") {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/v1/events/")
+	var body struct {
+		Params map[string]string `json:"params"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	id, err := Fire(name, body.Params, apiActor(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, map[string]string{"ID": id, "Name": name})
+}
+
+//	GET /v1/queues: Return contents of event queue and progress task queue
+func (a *apiServer) queues(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	queues, err := GetQueues()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, queues)
+}
+
+//	GET /v1/results?name=X&status=S&limit=N: List recent event results
+func (a *apiServer) history(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = 20
+	}
+	results, err := History(q.Get("name"), q.Get("status"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, results)
+}
+
+//	GET /v1/results/<id>[/<no>[/<node>]]: Return result of event, task or node
+func (a *apiServer) results(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	items := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/results/"), "/"), "/")
+	detail, err := GetEventDetail(items[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if len(items) == 1 {
+		writeJSON(w, detail)
+		return
+	}
+
+	no, err := strconv.Atoi(items[1])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, t := range detail.Tasks {
+		if t.Task.No != no {
+			continue
+		}
+		if len(items) == 2 {
+			writeJSON(w, t)
+			return
+		}
+		for _, n := range t.Nodes {
+			if n.Node == items[2] {
+				writeJSON(w, nodeTaskResultDetail{Result: &n, Log: n.Log})
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, errors.New(fmt.Sprintf("Result %s is not found", strings.Join(items, "/"))))
+}
+
+//	GET /v1/summary/<id>: Return result of event with all tasks and nodes without logs
+func (a *apiServer) summary(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/summary/"), "/")
+	detail, err := GetEventSummary(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+//	GET /v1/logs/<id>/<no>/<node>: Return log of node as plain text including log of running task
+func (a *apiServer) logs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	items := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/logs/"), "/"), "/")
+	if len(items) != 3 {
+		writeError(w, http.StatusNotFound, errors.New("Path must be /v1/logs/<id>/<no>/<node>"))
+		return
+	}
+	no, err := strconv.Atoi(items[1])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	text, _, err := readNodeLog(items[0], no, items[2], &logCursor{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(text))
+}
+
+//	POST /v1/cancel/<id>: Cancel event
+func (a *apiServer) cancel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "POST", "PUT") {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/cancel/")
+	if err := Cancel(id, apiActor(r)); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, map[string]string{"ID": id, "Status": "cancelled"})
+}
+
+//	GET /v1/pause: Return paused or not
+//	POST /v1/pause: Pause scheduler
+//	DELETE /v1/pause: Resume scheduler
+func (a *apiServer) pause(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "POST", "PUT", "DELETE") {
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case "POST", "PUT":
+		err = Pause(apiActor(r))
+	case "DELETE":
+		err = Resume(apiActor(r))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	paused, err := IsPaused()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, map[string]bool{"Paused": paused})
+}
+
+//	GET /v1/audit?event=X&action=A&since=24h&limit=N: List audit records
+func (a *apiServer) audit(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = 50
+	}
+	var since time.Time
+	if d, err := time.ParseDuration(q.Get("since")); err == nil {
+		since = time.Now().Add(-d)
+	}
+	records, err := Audit(q.Get("event"), q.Get("action"), since, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, records)
+}
+
+//	Return remote address of request to record in audit log
+func apiActor(r *http.Request) string {
+	return "api:" + r.RemoteAddr
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New(fmt.Sprintf("Method %s is not allowed", r.Method)))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("Failed to write response of HTTP API(%s)", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"Error": err.Error()})
+}
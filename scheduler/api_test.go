@@ -0,0 +1,276 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"metronome/util"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+const testTaskYAML = `
+events:
+  deploy:
+    task: restart
+tasks:
+  restart:
+    operations:
+      - echo: restart
+  backup:
+    operations:
+      - echo: backup
+`
+
+//	Create scheduler that has schedules unmarshalled from task.yml of each pattern
+func newTestScheduler(t *testing.T, sources map[string]string) *Scheduler {
+	s := &Scheduler{schedules: make(map[string]Schedule)}
+	for pattern, src := range sources {
+		var schedule Schedule
+		schedule.Default = taskDefault()
+		if err := yaml.Unmarshal([]byte(src), &schedule); err != nil {
+			t.Fatalf("Failed to unmarshal task.yml of %s(%s)", pattern, err)
+		}
+		schedule.PostUnmarshal("/opt/"+pattern+"/task.yml", pattern)
+		s.schedules[pattern] = schedule
+	}
+	return s
+}
+
+//	Serve request by handler of API and return status code and body
+func serveAPI(h http.HandlerFunc, method string, path string, token string) (int, string) {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set(API_TOKEN_HEADER, token)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestAPIAuth(t *testing.T) {
+	cases := []struct {
+		name     string
+		token    string
+		path     string
+		header   string
+		expected int
+	}{
+		{"no token", "secret", "/v1/schedules", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "/v1/schedules", "wrong", http.StatusUnauthorized},
+		{"header", "secret", "/v1/schedules", "secret", http.StatusOK},
+		{"query is ignored", "secret", "/v1/schedules?token=secret", "", http.StatusUnauthorized},
+		{"token is disabled", "", "/v1/schedules", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		a := &apiServer{scheduler: newTestScheduler(t, nil), token: c.token}
+		if code, body := serveAPI(a.auth(a.schedules), "GET", c.path, c.header); code != c.expected {
+			t.Errorf("%s: status = %d, want %d\n%s", c.name, code, c.expected, body)
+		}
+	}
+}
+
+func TestAPIAuthUnlessLoopback(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	cases := []struct {
+		name     string
+		addr     string
+		header   string
+		password string
+		expected int
+	}{
+		{"loopback", "127.0.0.1:8600", "", "", http.StatusOK},
+		{"no token", ":8600", "", "", http.StatusUnauthorized},
+		{"header", ":8600", "secret", "", http.StatusOK},
+		{"basic authentication", ":8600", "", "secret", http.StatusOK},
+		{"wrong password", ":8600", "", "wrong", http.StatusUnauthorized},
+	}
+	a := &apiServer{scheduler: newTestScheduler(t, nil), token: "secret"}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if c.header != "" {
+			r.Header.Set(API_TOKEN_HEADER, c.header)
+		}
+		if c.password != "" {
+			r.SetBasicAuth("metronome", c.password)
+		}
+		w := httptest.NewRecorder()
+		a.authUnlessLoopback(c.addr, ok)(w, r)
+		if w.Code != c.expected {
+			t.Errorf("%s: status = %d, want %d", c.name, w.Code, c.expected)
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); (w.Code == http.StatusUnauthorized) != (challenge != "") {
+			t.Errorf("%s: WWW-Authenticate = %q with status %d", c.name, challenge, w.Code)
+		}
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	cases := []struct {
+		addr     string
+		expected bool
+	}{
+		{"127.0.0.1:8600", true},
+		{"localhost:8600", true},
+		{"[::1]:8600", true},
+		{":8600", false},
+		{"0.0.0.0:8600", false},
+		{"192.168.0.1:8600", false},
+		{"127.0.0.1", false},
+	}
+	for _, c := range cases {
+		if actual := isLoopback(c.addr); actual != c.expected {
+			t.Errorf("isLoopback(%q) = %v, want %v", c.addr, actual, c.expected)
+		}
+	}
+}
+
+func TestAPISchedules(t *testing.T) {
+	a := &apiServer{scheduler: newTestScheduler(t, map[string]string{"app": testTaskYAML})}
+
+	code, body := serveAPI(a.schedules, "GET", "/v1/schedules", "")
+	var summaries []scheduleSummary
+	json.Unmarshal([]byte(body), &summaries)
+	expected := []scheduleSummary{{Pattern: "app", Path: "/opt/app/task.yml", Events: []string{"deploy"}, Tasks: []string{"backup", "restart"}}}
+	if code != http.StatusOK || !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("GET /v1/schedules = (%d, %s), want %v", code, body, expected)
+	}
+
+	//	Detail of schedule doesn't contain values that may be secrets
+	a = &apiServer{scheduler: newTestScheduler(t, map[string]string{"app": testTaskYAML, "secret": `
+environments:
+  PASSWORD: env-secret
+variables:
+  password: var-secret
+events:
+  deploy:
+    ordered_tasks:
+      - task: restart
+        with:
+          password: with-secret
+      - task: app:backup
+tasks:
+  restart:
+    operations:
+      - execute:
+          script: "echo {{password}}"
+      - echo: restarted
+notifications:
+  - url: http://example.com/hook
+    headers:
+      Authorization: header-secret
+`})}
+	code, body = serveAPI(a.schedule, "GET", "/v1/schedules/secret", "")
+	var detail scheduleDetail
+	json.Unmarshal([]byte(body), &detail)
+	expectedDetail := scheduleDetail{
+		Pattern: "secret",
+		Path:    "/opt/secret/task.yml",
+		Events:  []eventDetail{{Name: "deploy", Priority: 50, Tasks: []string{"restart", "app:backup"}}},
+		Tasks:   []taskDetail{{Name: "restart", Operations: []string{"execute", "echo"}}},
+	}
+	if code != http.StatusOK || !reflect.DeepEqual(detail, expectedDetail) {
+		t.Errorf("GET /v1/schedules/secret = (%d, %s), want %v", code, body, expectedDetail)
+	}
+	if strings.Contains(body, "-secret") {
+		t.Errorf("GET /v1/schedules/secret returns secrets\n%s", body)
+	}
+
+	cases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"GET", "/v1/schedules/app", http.StatusOK},
+		{"GET", "/v1/schedules/unknown", http.StatusNotFound},
+		{"POST", "/v1/schedules/app", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if code, body := serveAPI(a.schedule, c.method, c.path, ""); code != c.expected {
+			t.Errorf("%s %s: status = %d, want %d\n%s", c.method, c.path, code, c.expected, body)
+		}
+	}
+}
+
+func TestAPIControl(t *testing.T) {
+	startFakeConsul()
+	a := &apiServer{scheduler: newTestScheduler(t, nil)}
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	(&EventResult{ID: "1", Name: "deploy", Status: "inprogress", StartedAt: started}).Save()
+	(&EventResult{ID: "2", Name: "deploy", Status: "success", StartedAt: started, FinishedAt: started}).Save()
+
+	cases := []struct {
+		handler  http.HandlerFunc
+		method   string
+		path     string
+		expected int
+		body     string
+	}{
+		{a.pause, "GET", "/v1/pause", http.StatusOK, `"Paused":false`},
+		{a.pause, "POST", "/v1/pause", http.StatusOK, `"Paused":true`},
+		{a.pause, "GET", "/v1/pause", http.StatusOK, `"Paused":true`},
+		{a.pause, "DELETE", "/v1/pause", http.StatusOK, `"Paused":false`},
+		{a.cancel, "POST", "/v1/cancel/1", http.StatusOK, `"Status":"cancelled"`},
+		{a.cancel, "POST", "/v1/cancel/1", http.StatusConflict, `"Error"`},
+		{a.cancel, "POST", "/v1/cancel/2", http.StatusConflict, `"Error"`},
+		{a.cancel, "GET", "/v1/cancel/1", http.StatusMethodNotAllowed, `"Error"`},
+	}
+	for _, c := range cases {
+		code, body := serveAPI(c.handler, c.method, c.path, "")
+		if code != c.expected || !strings.Contains(body, c.body) {
+			t.Errorf("%s %s = (%d, %s), want (%d, %s)", c.method, c.path, code, body, c.expected, c.body)
+		}
+	}
+
+	if r, _ := getEventResult("1"); r == nil || r.Status != "cancelled" {
+		t.Errorf("Event result after cancel = %v, want cancelled", r)
+	}
+
+	//	Operations via API are recorded with remote address as actor
+	records, _ := Audit("", "", time.Time{}, 0)
+	var actions []string
+	for _, r := range records {
+		if !strings.HasPrefix(r.Actor, "api:") {
+			t.Errorf("Audit record of %s has actor %q", r.Action, r.Actor)
+		}
+		actions = append(actions, r.Action+":"+r.Result)
+	}
+	expected := []string{"cancel:error", "cancel:error", "cancel:success", "resume:success", "pause:success"}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Audit records = %v, want %v", actions, expected)
+	}
+}
+
+func TestAPILogs(t *testing.T) {
+	startFakeConsul()
+	a := &apiServer{scheduler: newTestScheduler(t, nil)}
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	(&NodeTaskResult{EventID: "1", No: 0, Node: "node1", Status: "success", Log: "done\n", StartedAt: started, FinishedAt: started}).Save()
+	running := &NodeTaskResult{EventID: "1", No: 1, Node: "node1", Status: "inprogress", StartedAt: started}
+	running.Save()
+	var b util.LogBuffer
+	b.Write([]byte("running\n"))
+	startLogStreamer(running, &b).Stop()
+
+	cases := []struct {
+		path     string
+		expected int
+		body     string
+	}{
+		{"/v1/logs/1/0/node1", http.StatusOK, "done\n"},
+		{"/v1/logs/1/1/node1", http.StatusOK, "running\n"},
+		{"/v1/logs/1/2/node1", http.StatusOK, ""},
+		{"/v1/logs/1/x/node1", http.StatusBadRequest, `"Error"`},
+		{"/v1/logs/1/0", http.StatusNotFound, `"Error"`},
+	}
+	for _, c := range cases {
+		code, body := serveAPI(a.logs, "GET", c.path, "")
+		if code != c.expected || !strings.Contains(body, c.body) {
+			t.Errorf("GET %s = (%d, %q), want (%d, %q)", c.path, code, body, c.expected, c.body)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"metronome/util"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+)
+
+const AUDIT_KEY = "metronome/audit"
+
+//	Record of operation that changes event queue or state of scheduler
+//	Action is one of push, fire, dispatch, cancel, pause and resume
+//	Result is accepted, duplicate or rejected on push, and success or error on others
+type AuditRecord struct {
+	Time      time.Time
+	Node      string
+	Actor     string            `json:",omitempty"`
+	Action    string
+	Result    string
+	EventID   string            `json:",omitempty"`
+	EventName string            `json:",omitempty"`
+	Params    map[string]string `json:",omitempty"`
+	Message   string            `json:",omitempty"`
+}
+
+type AuditRecords []AuditRecord
+
+func (r AuditRecords) Len() int {
+	return len(r)
+}
+
+func (r AuditRecords) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+func (r AuditRecords) Less(i, j int) bool {
+	return r[i].Time.Before(r[j].Time)
+}
+
+//	Append record to audit log on consul KVS without overwriting any other record
+//	Failure of audit is logged and doesn't stop original operation
+func audit(r AuditRecord) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.Node == "" {
+		r.Node, _ = os.Hostname()
+	}
+
+	d, err := json.Marshal(r)
+	if err != nil {
+		log.Warnf("Failed to marshal audit record(%s)", err)
+		return
+	}
+
+	//	CAS with zero index creates key only when it doesn't exist
+	kv := &api.KVPair{
+		Key:   fmt.Sprintf("%s/%020d-%s", AUDIT_KEY, r.Time.UnixNano(), r.Node),
+		Value: d,
+	}
+	ok, _, err := util.Consul().KV().CAS(kv, &api.WriteOptions{})
+	if err != nil {
+		log.Warnf("Failed to write audit record(%s)", err)
+		return
+	}
+	if !ok {
+		log.Warnf("Audit record %s already exists", kv.Key)
+	}
+}
+
+//	Return result of operation for audit record
+func auditResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+//	Return keys of all audit records in oldest first order
+//	Only keys are listed because values of audit records can be large in total
+func auditKeys() ([]string, error) {
+	keys, _, err := util.Consul().KV().Keys(AUDIT_KEY+"/", "", &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//	Return time of audit record from its key that begins with zero padded nanoseconds
+func auditKeyTime(key string) (time.Time, bool) {
+	name := strings.TrimPrefix(key, AUDIT_KEY+"/")
+	i := strings.Index(name, "-")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(name[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+//	Return audit records in newest first order that are filtered by event ID or name, action and time
+//	Records are read from newest key until limit is reached, and keys older than since aren't read
+func Audit(event string, action string, since time.Time, limit int) ([]AuditRecord, error) {
+	keys, err := auditKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var records AuditRecords
+	for i := len(keys) - 1; i >= 0; i-- {
+		if limit > 0 && len(records) >= limit {
+			break
+		}
+		if t, ok := auditKeyTime(keys[i]); ok && !since.IsZero() && t.Before(since) {
+			break
+		}
+
+		kv, _, err := util.Consul().KV().Get(keys[i], &api.QueryOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if kv == nil {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(kv.Value, &r); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to unmarshal audit record %s(%s)", kv.Key, err))
+		}
+		if event != "" && r.EventID != event && r.EventName != event {
+			continue
+		}
+		if action != "" && r.Action != action {
+			continue
+		}
+		if !since.IsZero() && r.Time.Before(since) {
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Sort(sort.Reverse(records))
+	return records, nil
+}
+
+//	Print audit records as table
+func PrintAudit(w io.Writer, records []AuditRecord) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tNODE\tACTOR\tACTION\tRESULT\tEVENT\tDETAIL")
+	for _, r := range records {
+		event := r.EventName
+		if r.EventID != "" {
+			event = fmt.Sprintf("%s(%s)", r.EventName, r.EventID)
+		}
+
+		var details []string
+		var keys []string
+		for k := range r.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			details = append(details, fmt.Sprintf("%s=%s", k, r.Params[k]))
+		}
+		if r.Message != "" {
+			details = append(details, r.Message)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", formatTime(r.Time), r.Node, orDash(r.Actor), r.Action, r.Result, orDash(event), strings.Join(details, " "))
+	}
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
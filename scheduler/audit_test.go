@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	startFakeConsul()
+	base := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return base.Add(time.Duration(minutes) * time.Minute)
+	}
+	audit(AuditRecord{Time: at(0), Node: "node1", Action: "push", Result: "accepted", EventID: "1", EventName: "deploy"})
+	audit(AuditRecord{Time: at(1), Node: "node1", Action: "dispatch", Result: "success", EventID: "1", EventName: "deploy"})
+	audit(AuditRecord{Time: at(2), Node: "node2", Action: "pause", Result: "success"})
+	audit(AuditRecord{Time: at(3), Node: "node1", Action: "push", Result: "rejected", EventID: "2", EventName: "backup"})
+
+	//	Record that has same time and node doesn't overwrite existing record
+	audit(AuditRecord{Time: at(3), Node: "node1", Action: "cancel", Result: "success", EventID: "2", EventName: "backup"})
+
+	cases := []struct {
+		name     string
+		event    string
+		action   string
+		since    time.Time
+		limit    int
+		expected []string
+	}{
+		{"all", "", "", time.Time{}, 0, []string{"push:rejected", "pause:success", "dispatch:success", "push:accepted"}},
+		{"event name", "deploy", "", time.Time{}, 0, []string{"dispatch:success", "push:accepted"}},
+		{"event id", "2", "", time.Time{}, 0, []string{"push:rejected"}},
+		{"action", "", "push", time.Time{}, 0, []string{"push:rejected", "push:accepted"}},
+		{"since", "", "", at(2), 0, []string{"push:rejected", "pause:success"}},
+		{"limit", "", "", time.Time{}, 3, []string{"push:rejected", "pause:success", "dispatch:success"}},
+		{"no match", "restore", "", time.Time{}, 0, nil},
+	}
+	for _, c := range cases {
+		records, err := Audit(c.event, c.action, c.since, c.limit)
+		if err != nil {
+			t.Errorf("%s: Audit() returns error: %s", c.name, err)
+			continue
+		}
+		var actual []string
+		for _, r := range records {
+			actual = append(actual, r.Action+":"+r.Result)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: Audit() = %v, want %v", c.name, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"metronome/config"
+	"metronome/util"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+//	In-memory consul KVS that serves /v1/kv and /v1/session to client of util.Consul
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	kvs      map[string]*api.KVPair
+	sessions int
+}
+
+var (
+	testConsul     *fakeConsul
+	testConsulOnce sync.Once
+)
+
+//	Return fake consul with empty KVS, util.Consul connects to it in all tests of this package
+func startFakeConsul() *fakeConsul {
+	testConsulOnce.Do(func() {
+		testConsul = &fakeConsul{}
+		server := httptest.NewServer(testConsul)
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		config.Hostname = host
+		config.Port, _ = strconv.Atoi(port)
+		config.Protocol = "http"
+		util.Consul()
+	})
+
+	testConsul.mu.Lock()
+	defer testConsul.mu.Unlock()
+	testConsul.index = 1
+	testConsul.kvs = make(map[string]*api.KVPair)
+	return testConsul
+}
+
+//	Return keys under prefix in order
+func (c *fakeConsul) keys(prefix string) []string {
+	var keys []string
+	for k := range c.kvs {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//	Return value of key, or empty string when key doesn't exist
+func (c *fakeConsul) value(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if kv, found := c.kvs[key]; found {
+		return string(kv.Value)
+	}
+	return ""
+}
+
+//	Put value to key directly without client
+func (c *fakeConsul) put(key string, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index += 1
+	c.kvs[key] = &api.KVPair{Key: key, Value: []byte(value), CreateIndex: c.index, ModifyIndex: c.index}
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	//	Blocking query returns when index has been changed or after a while instead of wait time
+	if index, err := strconv.ParseUint(q.Get("index"), 10, 64); err == nil {
+		for i := 0; i < 10; i++ {
+			c.mu.Lock()
+			changed := c.index > index
+			c.mu.Unlock()
+			if changed {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		c.sessions += 1
+		json.NewEncoder(w).Encode(map[string]string{"ID": fmt.Sprintf("session-%d", c.sessions)})
+		return
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		json.NewEncoder(w).Encode([]map[string]string{{"ID": strings.TrimPrefix(r.URL.Path, "/v1/session/renew/"), "TTL": "15s"}})
+		return
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		w.Write([]byte("true"))
+		return
+	case !strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	switch r.Method {
+	case "GET":
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+		var result interface{}
+		switch {
+		case q["keys"] != nil:
+			var keys []string
+			found := make(map[string]bool)
+			for _, k := range c.keys(key) {
+				if sep := q.Get("separator"); sep != "" {
+					if i := strings.Index(k[len(key):], sep); i >= 0 {
+						k = k[:len(key)+i+len(sep)]
+					}
+				}
+				if !found[k] {
+					found[k] = true
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			result = keys
+		case q["recurse"] != nil:
+			var kvs []*api.KVPair
+			for _, k := range c.keys(key) {
+				kvs = append(kvs, c.kvs[k])
+			}
+			if len(kvs) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			result = kvs
+		default:
+			kv, found := c.kvs[key]
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			result = []*api.KVPair{kv}
+		}
+		json.NewEncoder(w).Encode(result)
+	case "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		kv, found := c.kvs[key]
+		if cas := q.Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if (index == 0 && found) || (index != 0 && (!found || kv.ModifyIndex != index)) {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		if session := q.Get("acquire"); session != "" && found && kv.Session != "" && kv.Session != session {
+			w.Write([]byte("false"))
+			return
+		}
+		if session := q.Get("release"); session != "" && (!found || kv.Session != session) {
+			w.Write([]byte("false"))
+			return
+		}
+		c.index += 1
+		if !found {
+			kv = &api.KVPair{Key: key, CreateIndex: c.index}
+			c.kvs[key] = kv
+		}
+		kv.Value = body
+		kv.ModifyIndex = c.index
+		if session := q.Get("acquire"); session != "" {
+			kv.Session = session
+			kv.LockIndex += 1
+		}
+		if q.Get("release") != "" {
+			kv.Session = ""
+		}
+		w.Write([]byte("true"))
+	case "DELETE":
+		if q["recurse"] != nil {
+			for _, k := range c.keys(key) {
+				delete(c.kvs, k)
+			}
+		} else {
+			delete(c.kvs, key)
+		}
+		c.index += 1
+		w.Write([]byte("true"))
+	}
+}
@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metronome/config"
+	"metronome/queue"
+	"metronome/util"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+)
+
+const PAUSE_KEY = "metronome/paused"
+
+//	Contents of event queue and progress task queue
+type Queues struct {
+	Events []api.UserEvent
+	Tasks  []EventTask
+}
+
+//	Fire consul event with ACL token and parameters in payload as same as consul-event operation
+//	Actor describes who fires event(ex. "cli:root") in audit log
+func Fire(name string, params map[string]string, actor string) (string, error) {
+	payload, err := json.Marshal(Payload{Token: config.Token, Params: params})
+	if err != nil {
+		return "", err
+	}
+	if len(params) == 0 {
+		payload = []byte(config.Token)
+	}
+
+	event := &api.UserEvent{
+		Name:    name,
+		Payload: payload,
+	}
+	id, _, err := util.Consul().Event().Fire(event, &api.WriteOptions{})
+	audit(AuditRecord{Actor: actor, Action: "fire", Result: auditResult(err), EventID: id, EventName: name, Params: params})
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Fire %s event(ID: %s)", name, id)
+	return id, nil
+}
+
+//	Interval of polling result of event while waiting for it
+const WAIT_EVENT_INTERVAL = 2 * time.Second
+
+//	Max duration to wait for event that has neither result nor entry in event queue,
+//	because no agent will start event that isn't defined in any task.yml
+const WAIT_EVENT_START_TIME = 60 * time.Second
+
+//	Wait until event has finished and return its results
+//	Zero timeout waits forever after event has been queued or started
+func WaitEvent(id string, timeout time.Duration) (*EventDetail, error) {
+	return waitEvent(id, timeout, WAIT_EVENT_INTERVAL, WAIT_EVENT_START_TIME)
+}
+
+func waitEvent(id string, timeout time.Duration, interval time.Duration, startTime time.Duration) (*EventDetail, error) {
+	started := time.Now()
+	for {
+		result, err := getEventResult(id)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil && !result.FinishedAt.IsZero() {
+			return GetEventDetail(id)
+		}
+		if timeout > 0 && time.Since(started) > timeout {
+			return nil, errors.New(fmt.Sprintf("Timeout expired while waiting for event %s", id))
+		}
+		if result == nil && time.Since(started) > startTime {
+			queued, err := isQueued(id)
+			if err != nil {
+				return nil, err
+			}
+			if !queued {
+				return nil, errors.New(fmt.Sprintf("Event %s has not been started by any agent in %s, it may not be defined in any task.yml", id, startTime))
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+//	Return true when event is waiting in event queue
+func isQueued(id string) (bool, error) {
+	queues, err := GetQueues()
+	if err != nil {
+		return false, err
+	}
+	for _, e := range queues.Events {
+		if e.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//	Remove event from event queue and its tasks from progress task queue
+//	Tasks that have already started on any node will continue until finished
+func Cancel(id string, actor string) error {
+	name, err := cancel(id)
+	record := AuditRecord{Actor: actor, Action: "cancel", Result: auditResult(err), EventID: id, EventName: name}
+	if err != nil {
+		record.Message = err.Error()
+	}
+	audit(record)
+	return err
+}
+
+func cancel(id string) (string, error) {
+	l, err := lockCriticalSection()
+	if err != nil {
+		return "", err
+	}
+	defer l.Unlock()
+
+	eq := &queue.Queue{
+		Client: util.Consul(),
+		Key:    EVENT_QUEUE_KEY,
+	}
+	var name string
+	events, err := eq.Remove(func(item json.RawMessage) bool {
+		var e api.UserEvent
+		if json.Unmarshal(item, &e) == nil && e.ID == id {
+			name = e.Name
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return name, err
+	}
+
+	pq := &queue.Queue{
+		Client: util.Consul(),
+		Key:    PROGRESS_QUEUE_KEY,
+	}
+	tasks, err := pq.Remove(func(item json.RawMessage) bool {
+		var et EventTask
+		return json.Unmarshal(item, &et) == nil && et.ID == id
+	})
+	if err != nil {
+		return name, err
+	}
+
+	//	Log cancelling event as EventResult on KVS
+	result, err := getEventResult(id)
+	if err != nil {
+		return name, err
+	}
+	if result == nil {
+		if events == 0 {
+			return "", errors.New(fmt.Sprintf("Event %s is not found", id))
+		}
+		result = &EventResult{ID: id, Name: name, StartedAt: time.Now()}
+	}
+	if !result.FinishedAt.IsZero() && tasks == 0 {
+		return result.Name, errors.New(fmt.Sprintf("Event %s has already finished", id))
+	}
+
+	log.Infof("Cancel event(ID: %s, Name: %s)", id, result.Name)
+	result.Status = "cancelled"
+	result.FinishedAt = time.Now()
+	if err := result.Save(); err != nil {
+		return result.Name, err
+	}
+	eventsFinished.Inc(result.Name, result.Status)
+	return result.Name, nil
+}
+
+//	Stop dispatching events and starting tasks until resumed
+func Pause(actor string) error {
+	node, _ := os.Hostname()
+	kv := &api.KVPair{
+		Key:   PAUSE_KEY,
+		Value: []byte(fmt.Sprintf("Paused by %s at %s", node, time.Now().Format(time.RFC3339))),
+	}
+	_, err := util.Consul().KV().Put(kv, &api.WriteOptions{})
+	audit(AuditRecord{Actor: actor, Action: "pause", Result: auditResult(err)})
+	return err
+}
+
+func Resume(actor string) error {
+	_, err := util.Consul().KV().Delete(PAUSE_KEY, &api.WriteOptions{})
+	audit(AuditRecord{Actor: actor, Action: "resume", Result: auditResult(err)})
+	return err
+}
+
+func IsPaused() (bool, error) {
+	kv, _, err := util.Consul().KV().Get(PAUSE_KEY, &api.QueryOptions{})
+	if err != nil {
+		return false, err
+	}
+	return kv != nil, nil
+}
+
+//	Return contents of event queue and progress task queue
+func GetQueues() (*Queues, error) {
+	queues := &Queues{}
+
+	eq := &queue.Queue{
+		Client: util.Consul(),
+		Key:    EVENT_QUEUE_KEY,
+	}
+	if err := eq.Items(&queues.Events); err != nil {
+		return nil, err
+	}
+	//	Hide ACL token in payload
+	for i := range queues.Events {
+		queues.Events[i].Payload = nil
+	}
+
+	pq := &queue.Queue{
+		Client: util.Consul(),
+		Key:    PROGRESS_QUEUE_KEY,
+	}
+	if err := pq.Items(&queues.Tasks); err != nil {
+		return nil, err
+	}
+	return queues, nil
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitEvent(t *testing.T) {
+	consul := startFakeConsul()
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	(&EventResult{ID: "1", Name: "deploy", Status: "success", StartedAt: started, FinishedAt: started}).Save()
+	(&EventResult{ID: "2", Name: "deploy", Status: "inprogress", StartedAt: started}).Save()
+	consul.put(EVENT_QUEUE_KEY, `[{"ID": "3", "Name": "deploy"}]`)
+
+	cases := []struct {
+		name    string
+		id      string
+		timeout time.Duration
+		err     string
+	}{
+		{"finished", "1", 0, ""},
+		{"running until timeout", "2", 50 * time.Millisecond, "Timeout expired"},
+		{"queued until timeout", "3", 50 * time.Millisecond, "Timeout expired"},
+		{"never started", "4", 0, "has not been started by any agent"},
+	}
+	for _, c := range cases {
+		detail, err := waitEvent(c.id, c.timeout, 10*time.Millisecond, 20*time.Millisecond)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: waitEvent() returns error %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: waitEvent() returns error: %s", c.name, err)
+			continue
+		}
+		if detail.Event.ID != c.id || detail.Event.Status != "success" {
+			t.Errorf("%s: waitEvent() returns %v", c.name, detail.Event)
+		}
+	}
+}
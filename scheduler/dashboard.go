@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"net/http"
+)
+
+//	GET /: Serve read-only dashboard that polls HTTP API
+//	Dashboard is embedded in binary and doesn't depend on external resources
+func (a *apiServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(DASHBOARD_HTML))
+}
+
+const DASHBOARD_HTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>metronome</title>
+<style>
+  body { font-family: sans-serif; font-size: 13px; margin: 16px; color: #222; }
+  h1 { font-size: 18px; margin: 0 0 4px 0; }
+  h2 { font-size: 14px; margin: 20px 0 6px 0; border-bottom: 1px solid #ccc; }
+  table { border-collapse: collapse; }
+  th, td { border: 1px solid #ddd; padding: 3px 8px; text-align: left; white-space: nowrap; }
+  th { background: #f4f4f4; }
+  .success { background: #dff0d8; }
+  .error, .timeout, .cancelled { background: #f2dede; }
+  .inprogress { background: #fcf8e3; }
+  .skipped, .skip { background: #eee; }
+  #state { color: #666; }
+  #paused { color: #a94442; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>metronome</h1>
+<div id="state"></div>
+<div id="paused"></div>
+
+<h2>Running task</h2>
+<div id="running"></div>
+
+<h2>Progress task queue</h2>
+<table id="tasks"></table>
+
+<h2>Event queue</h2>
+<table id="events"></table>
+
+<h2>Recent events</h2>
+<table id="history"></table>
+
+<h2>Detail</h2>
+<pre id="detail"></pre>
+
+<script>
+(function() {
+  // Token is kept in session storage instead of URL to keep it from being leaked by links and history
+  var token = sessionStorage.getItem("metronome-token") || "";
+
+  function request(path, callback) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("GET", path);
+    var sent = token;
+    xhr.setRequestHeader("X-Metronome-Token", sent);
+    xhr.onload = function() {
+      if (xhr.status == 200) {
+        callback(xhr.responseText);
+      } else if (xhr.status == 401 && sent == token) {
+        token = prompt("Token of HTTP API") || "";
+        sessionStorage.setItem("metronome-token", token);
+      } else {
+        document.getElementById("state").textContent = "Failed to get " + path + "(" + xhr.status + ")";
+      }
+    };
+    xhr.send();
+  }
+
+  function get(path, callback) {
+    request(path, function(body) { callback(JSON.parse(body)); });
+  }
+
+  // Show log or result in page because links can't send token in header
+  // Path is read from data-path attribute instead of inline handler to keep values in it from being run as script
+  document.addEventListener("click", function(e) {
+    var path = e.target.getAttribute && e.target.getAttribute("data-path");
+    if (!path) { return; }
+    e.preventDefault();
+    request(path, function(body) { document.getElementById("detail").textContent = body; });
+  });
+
+  function text(s) {
+    return String(s === undefined || s === null ? "" : s).replace(/[&<>"']/g, function(c) {
+      return { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }[c];
+    });
+  }
+
+  function duration(started, finished) {
+    if (!started) { return "-"; }
+    var end = finished ? new Date(finished) : new Date();
+    return Math.round((end - new Date(started)) / 1000) + "s";
+  }
+
+  function table(id, header, rows) {
+    var html = "<tr>" + header.map(function(h) { return "<th>" + text(h) + "</th>"; }).join("") + "</tr>";
+    rows.forEach(function(row) { html += "<tr>" + row.join("") + "</tr>"; });
+    document.getElementById(id).innerHTML = html;
+  }
+
+  function cell(s, status) {
+    return '<td class="' + text(status) + '">' + s + "</td>";
+  }
+
+  function logLink(id, no, node) {
+    var path = "v1/logs/" + encodeURIComponent(id) + "/" + no + "/" + encodeURIComponent(node);
+    return '<a href="#detail" data-path="' + text(path) + '">log</a>';
+  }
+
+  function refreshRunning(head) {
+    if (!head) {
+      document.getElementById("running").textContent = "No task is running";
+      return;
+    }
+    get("v1/summary/" + encodeURIComponent(head.id), function(summary) {
+      var detail = (summary.Tasks || []).filter(function(t) { return t.Task.No == head.no; })[0] || {};
+      var html = "<p>" + text(head.event) + " / " + text(head.id) + " / task " + head.no + "(" + text(head.task) + ")</p>";
+      html += "<table><tr><th>NODE</th><th>STATUS</th><th>DURATION</th><th></th></tr>";
+      (detail.Nodes || []).forEach(function(n) {
+        html += "<tr>" + cell(text(n.Node), n.Status) + cell(text(n.Status), n.Status) +
+          "<td>" + duration(n.StartedAt, n.FinishedAt) + "</td><td>" + logLink(head.id, head.no, n.Node) + "</td></tr>";
+      });
+      document.getElementById("running").innerHTML = html + "</table>";
+    });
+  }
+
+  function refresh() {
+    get("v1/queues", function(queues) {
+      var tasks = queues.Tasks || [];
+      table("tasks", ["NO", "EVENT", "ID", "TASK", "SERVICE", "TAG"], tasks.map(function(t) {
+        return [cell(t.no), cell(text(t.event)), cell(text(t.id)), cell(text(t.task)), cell(text(t.service)), cell(text(t.tag))];
+      }));
+      table("events", ["ID", "NAME"], (queues.Events || []).map(function(e) {
+        return [cell(text(e.ID)), cell(text(e.Name))];
+      }));
+      refreshRunning(tasks[0]);
+    });
+
+    get("v1/results?limit=20", function(results) {
+      table("history", ["ID", "NAME", "STATUS", "STARTED", "DURATION"], (results || []).map(function(r) {
+        var path = "v1/summary/" + encodeURIComponent(r.ID);
+        return [cell('<a href="#detail" data-path="' + text(path) + '">' + text(r.ID) + "</a>"),
+          cell(text(r.Name)), cell(text(r.Status), r.Status), cell(text(r.StartedAt)), cell(duration(r.StartedAt, r.FinishedAt))];
+      }));
+    });
+
+    get("v1/pause", function(state) {
+      document.getElementById("paused").textContent = state.Paused ? "Scheduler is paused" : "";
+    });
+
+    document.getElementById("state").textContent = "Updated at " + new Date().toLocaleString();
+  }
+
+  refresh();
+  setInterval(refresh, 3000);
+})();
+</script>
+</body>
+</html>
+`
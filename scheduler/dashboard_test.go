@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	a := &apiServer{scheduler: newTestScheduler(t, nil)}
+
+	cases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"GET", "/", http.StatusOK},
+		{"GET", "/index.html", http.StatusNotFound},
+		{"POST", "/", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		code, body := serveAPI(a.dashboard, c.method, c.path, "")
+		if code != c.expected {
+			t.Errorf("%s %s: status = %d, want %d", c.method, c.path, code, c.expected)
+		}
+		if code == http.StatusOK && !strings.Contains(body, "<title>metronome</title>") {
+			t.Errorf("%s %s doesn't return dashboard", c.method, c.path)
+		}
+	}
+
+	//	Values in results must not be put into inline script
+	if strings.Contains(DASHBOARD_HTML, "onclick") {
+		t.Errorf("Dashboard has inline event handler")
+	}
+
+	//	Dashboard must not depend on external resources
+	for _, s := range []string{"http://", "https://", "//cdn"} {
+		if strings.Contains(DASHBOARD_HTML, s) {
+			t.Errorf("Dashboard refers external resource(%s)", s)
+		}
+	}
+}
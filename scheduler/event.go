@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"metronome/config"
 	"metronome/util"
+
+	log "github.com/Sirupsen/logrus"
 )
 
 type Event struct {
@@ -52,12 +54,16 @@ func (e *Event) Run(scheduler *Scheduler) error {
 			},
 		}
 	} else {
-		tasks = e.OrderedTasks
+		for _, et := range e.OrderedTasks {
+			et.Pattern = e.Pattern
+			tasks = append(tasks, et)
+		}
 	}
 
 	//	Execute each task exact order
+	logger := log.NewEntry(log.StandardLogger())
 	for _, et := range tasks {
-		if err := et.Run(scheduler); err != nil {
+		if _, err := et.Run(scheduler, logger); err != nil {
 			return err
 		}
 	}
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"metronome/config"
+	"metronome/task"
 	"metronome/util"
-	"strconv"
 	"strings"
 	"time"
 
@@ -18,9 +18,14 @@ type EventTask struct {
 	Pattern   string
 	ID        string
 	No        int
+	Event     string
 	Service   string
 	Tag       string
 	Task      string
+	When      string
+	With      map[string]string
+	Params    map[string]string
+	Filter    task.Filter
 	Skippable bool
 }
 
@@ -33,29 +38,53 @@ func (et *EventTask) UnmarshalJSON(d []byte) error {
 	u.Unmarshal([]byte(m["pattern"]), &et.Pattern)
 	u.Unmarshal([]byte(m["id"]), &et.ID)
 	u.Unmarshal([]byte(m["no"]), &et.No)
+	u.Unmarshal([]byte(m["event"]), &et.Event)
 	u.Unmarshal([]byte(m["service"]), &et.Service)
 	u.Unmarshal([]byte(m["tag"]), &et.Tag)
 	u.Unmarshal([]byte(m["task"]), &et.Task)
+	u.Unmarshal([]byte(m["when"]), &et.When)
+	u.Unmarshal([]byte(m["with"]), (*util.StringMap)(&et.With))
+	u.Unmarshal([]byte(m["params"]), &et.Params)
+	u.Unmarshal([]byte(m["filter"]), &et.Filter)
 	u.Unmarshal([]byte(m["skippable"]), &et.Skippable)
 	return u.Err
 }
 
 func (et EventTask) MarshalJSON() ([]byte, error) {
 	et.Skippable = config.Skippable
+
+	//	Encode each value with json.Marshal to escape quotations and control characters in them
+	values := []struct {
+		key   string
+		value interface{}
+	}{
+		{"pattern", et.Pattern},
+		{"id", et.ID},
+		{"no", et.No},
+		{"event", et.Event},
+		{"service", et.Service},
+		{"tag", et.Tag},
+		{"task", et.Task},
+		{"when", et.When},
+		{"with", et.With},
+		{"params", et.Params},
+		{"filter", et.Filter},
+		{"skippable", et.Skippable},
+	}
 	var fields []string
-	fields = append(fields, fmt.Sprintf("\"pattern\": \"%s\"", et.Pattern))
-	fields = append(fields, fmt.Sprintf("\"id\": \"%s\"", et.ID))
-	fields = append(fields, fmt.Sprintf("\"no\": %d", et.No))
-	fields = append(fields, fmt.Sprintf("\"service\": \"%s\"", et.Service))
-	fields = append(fields, fmt.Sprintf("\"tag\": \"%s\"", et.Tag))
-	fields = append(fields, fmt.Sprintf("\"task\": \"%s\"", et.Task))
-	fields = append(fields, fmt.Sprintf("\"skippable\": %s", strconv.FormatBool(et.Skippable)))
+	for _, v := range values {
+		d, err := json.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, fmt.Sprintf("\"%s\": %s", v.key, d))
+	}
 	return []byte(fmt.Sprintf("{ %s }", strings.Join(fields, ","))), nil
 }
 
 func (et *EventTask) Runnable(node string) bool {
 	//	Target node doesn't have conditional service or tag
-	if !util.HasCatalogRecord(node, et.Service, et.Tag) {
+	if !et.hasCatalogRecord(node) {
 		return false
 	}
 
@@ -75,7 +104,7 @@ func (et *EventTask) IsFinished(ch chan EventTask) bool {
 	select {
 	case timeout := <-ch:
 		if et.ID == timeout.ID && et.No == timeout.No {
-			log.Errorf("Task has been reached timeout(%s)", et.String())
+			log.WithFields(et.logFields("")).Errorf("Task has been reached timeout(%s)", et.String())
 			return true
 		}
 	default:
@@ -106,21 +135,102 @@ func (et *EventTask) filterNodes(nodes []*api.Node) []*api.Node {
 	var results []*api.Node
 	for _, node := range nodes {
 		r, err := getNodeTaskResult(et.ID, et.No, node.Node)
-		if err == nil && r != nil || util.HasCatalogRecord(node.Node, et.Service, et.Tag) {
+		if err == nil && r != nil || et.hasCatalogRecord(node.Node) {
 			results = append(results, node)
 		}
 	}
 	return results
 }
 
+//	Return status that target node satisfies both filters on event task and task definition
+//	Task definition that has tag only inherits service from event task
+func (et *EventTask) hasCatalogRecord(node string) bool {
+	if !util.HasCatalogRecord(node, et.Service, et.Tag) {
+		return false
+	}
+	if et.Filter.Service == "" && et.Filter.Tag == "" {
+		return true
+	}
+
+	service := et.Filter.Service
+	if service == "" {
+		service = et.Service
+	}
+	return util.HasCatalogRecord(node, service, et.Filter.Tag)
+}
+
+//	Fields to identify event task in structured log
+func (et *EventTask) logFields(node string) log.Fields {
+	fields := log.Fields{
+		"event_id":   et.ID,
+		"event_name": et.Event,
+		"no":         et.No,
+		"pattern":    et.Pattern,
+		"task":       et.Task,
+	}
+	if node != "" {
+		fields["node"] = node
+	}
+	return fields
+}
+
 //	Run operations in task
-func (et *EventTask) Run(scheduler *Scheduler) error {
-	t, found := scheduler.schedules[et.Pattern].Tasks[et.Task]
+func (et *EventTask) Run(scheduler *Scheduler, logger *log.Entry) ([]task.OperationResult, error) {
+	//	Running task keeps definition that has been loaded at start even if schedules are reloaded
+	//	Task in other pattern is referred by "pattern:task" and runs with variables of its pattern
+	schedule, t, found := scheduler.findTask(et.Pattern, et.Task)
 	if !found {
-		return errors.New(fmt.Sprintf("Target task(%s) does not defined in %s\n", et.Task, et.Pattern))
-	} else {
-		return t.Run(scheduler.schedules[t.Pattern].Variables)
+		return nil, errors.New(fmt.Sprintf("Target task(%s) does not defined in %s\n", et.Task, et.Pattern))
 	}
+
+	args, err := et.arguments(scheduler, schedule, t)
+	if err != nil {
+		return nil, err
+	}
+	vars := et.variables(scheduler, schedule, args)
+
+	//	Skip task when conditional expression on event task is false
+	ok, err := util.Evaluate(et.When, vars)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		logger.Infof("Task %s has been skipped by condition(%s)", et.Task, et.When)
+		return nil, task.ErrSkipped
+	}
+	return t.Run(logger, vars)
+}
+
+//	Resolve arguments of task, {{variables}} in them are replaced by variables of pattern and event parameters
+func (et *EventTask) arguments(scheduler *Scheduler, schedule Schedule, t *task.Task) (map[string]string, error) {
+	args, err := t.Arguments(et.With)
+	if err != nil {
+		return nil, err
+	}
+	vars := et.variables(scheduler, schedule, nil)
+	for k, v := range args {
+		if args[k], err = util.Render(v, vars); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to render argument %s of task %s(%s)", k, et.Task, err))
+		}
+	}
+	return args, nil
+}
+
+//	Merge variables in task.yml with arguments of task, event information and event parameters
+//	Only variables in task.yml and variables.yml are rendered as template again when they are referred,
+//	event parameters including trigger.* and rendered arguments are literals to keep them from calling functions
+func (et *EventTask) variables(scheduler *Scheduler, schedule Schedule, args map[string]string) map[string]string {
+	vars := schedule.variables()
+	for k, v := range args {
+		vars[k] = util.Literal(v)
+	}
+	for k, v := range et.Params {
+		vars[k] = util.Literal(v)
+	}
+	vars["event.id"] = util.Literal(et.ID)
+	vars["event.name"] = util.Literal(et.Event)
+	vars["node"] = util.Literal(scheduler.node)
+	return vars
 }
 
 func (et *EventTask) GetResult() (*TaskResult, error) {
@@ -134,6 +244,7 @@ func (et *EventTask) GetResult() (*TaskResult, error) {
 			EventID:   et.ID,
 			No:        et.No,
 			Name:      et.Task,
+			Pattern:   et.Pattern,
 			Status:    "inprogress",
 			StartedAt: time.Now(),
 		}
@@ -141,7 +252,7 @@ func (et *EventTask) GetResult() (*TaskResult, error) {
 	return result, nil
 }
 
-func (et *EventTask) WriteStartLog(node string) error {
+func (et *EventTask) WriteStartLog(node string, args map[string]string) error {
 	//	Log starting task as TaskResult on KVS
 	result, err := getTaskResult(et.ID, et.No)
 	if err != nil {
@@ -152,6 +263,8 @@ func (et *EventTask) WriteStartLog(node string) error {
 			EventID:   et.ID,
 			No:        et.No,
 			Name:      et.Task,
+			Pattern:   et.Pattern,
+			Arguments: args,
 			Status:    "inprogress",
 			StartedAt: time.Now(),
 		}
@@ -165,13 +278,15 @@ func (et *EventTask) WriteStartLog(node string) error {
 		EventID:   et.ID,
 		No:        et.No,
 		Node:      node,
+		Pattern:   et.Pattern,
+		Task:      et.Task,
 		Status:    "inprogress",
 		StartedAt: time.Now(),
 	}
 	return nodeResult.Save()
 }
 
-func (et *EventTask) WriteFinishLog(node string, status string, log string) error {
+func (et *EventTask) WriteFinishLog(node string, status string, log string, operations []task.OperationResult, taskErr error) error {
 	//	Log finishing task on node as NodeTaskResult on KVS
 	nodeResult, err := getNodeTaskResult(et.ID, et.No, node)
 	if err != nil {
@@ -180,6 +295,11 @@ func (et *EventTask) WriteFinishLog(node string, status string, log string) erro
 	nodeResult.FinishedAt = time.Now()
 	nodeResult.Status = status
 	nodeResult.Log = log
+	nodeResult.Operations = operations
+	if taskErr != nil && taskErr != task.ErrSkipped {
+		nodeResult.Error = taskErr.Error()
+		nodeResult.ExitCode = util.ExitCode(taskErr)
+	}
 
 	return nodeResult.Save()
 }
@@ -192,5 +312,8 @@ func (et EventTask) String() string {
 	fields = append(fields, fmt.Sprintf("Service: %s", et.Service))
 	fields = append(fields, fmt.Sprintf("Tag: %s", et.Tag))
 	fields = append(fields, fmt.Sprintf("Task: %s", et.Task))
+	if et.When != "" {
+		fields = append(fields, fmt.Sprintf("When: %s", et.When))
+	}
 	return strings.Join(fields, ", ")
 }
@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"metronome/config"
+	"metronome/task"
+	"reflect"
+	"testing"
+)
+
+func TestEventTaskMarshalJSON(t *testing.T) {
+	defer func(skippable bool) { config.Skippable = skippable }(config.Skippable)
+	config.Skippable = true
+
+	et := EventTask{
+		Pattern: `pat"tern`,
+		ID:      "id\\1",
+		No:      2,
+		Event:   "deploy\n",
+		Service: "web\t",
+		Tag:     `"primary"`,
+		Task:    "db:restart",
+		When:    `role == "web"`,
+		With:    map[string]string{"version": `"1.0"`},
+		Params:  map[string]string{"message": "line1\nline2"},
+		Filter:  task.Filter{Service: "web", Tag: `a"b`},
+	}
+	d, err := json.Marshal(et)
+	if err != nil {
+		t.Fatalf("Marshal() returns error: %s", err)
+	}
+
+	var actual EventTask
+	if err := json.Unmarshal(d, &actual); err != nil {
+		t.Fatalf("Unmarshal() returns error: %s\n%s", err, d)
+	}
+	et.Skippable = true
+	if !reflect.DeepEqual(actual, et) {
+		t.Errorf("Unmarshal(Marshal()) = %+v, want %+v", actual, et)
+	}
+}
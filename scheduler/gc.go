@@ -0,0 +1,255 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"metronome/config"
+	"metronome/util"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+)
+
+const LEADER_LOCK_KEY = "metronome/leader"
+const EXECUTED_EVENT_KEY = "metronome/executed"
+
+//	Tombstone is kept at least this duration because event buffer of other agents may still have the event
+const TOMBSTONE_MIN_AGE = 7 * 24 * time.Hour
+
+//	Policies to delete old event results and audit records
+//	Event result is deleted when it is older than Age or it isn't in latest Count results of same event name,
+//	but latest KeepFailed failed results and unfinished results are always kept
+//	Audit record is deleted when it is older than AuditAge
+type RetentionPolicy struct {
+	Age        time.Duration
+	Count      int
+	KeepFailed int
+	AuditAge   time.Duration
+}
+
+func retentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		Age:        time.Duration(config.RetentionDays) * 24 * time.Hour,
+		Count:      config.RetentionCount,
+		KeepFailed: config.RetentionKeepFailed,
+		AuditAge:   time.Duration(config.AuditRetentionDays) * 24 * time.Hour,
+	}
+}
+
+//	Return keys of audit records that should be deleted by retention policy
+func (p RetentionPolicy) expiredAudit(keys []string, now time.Time) []string {
+	if p.AuditAge <= 0 {
+		return nil
+	}
+	threshold := now.Add(-p.AuditAge)
+	var expired []string
+	for _, k := range keys {
+		t, ok := auditKeyTime(k)
+		if ok && t.Before(threshold) {
+			expired = append(expired, k)
+		}
+	}
+	return expired
+}
+
+//	Return event results that should be deleted by retention policy
+func (p RetentionPolicy) expired(results []EventResult, now time.Time) []EventResult {
+	var expired []EventResult
+
+	//	Group event results by name in newest first order
+	groups := make(map[string][]EventResult)
+	for _, r := range results {
+		groups[r.Name] = append(groups[r.Name], r)
+	}
+	for _, group := range groups {
+		sort.Sort(sort.Reverse(EventResults(group)))
+
+		failed := 0
+		for i, r := range group {
+			if r.FinishedAt.IsZero() {
+				continue
+			}
+			if r.IsFailed() {
+				failed += 1
+				if failed <= p.KeepFailed {
+					continue
+				}
+			}
+
+			tooOld := p.Age > 0 && now.Sub(r.StartedAt) > p.Age
+			tooMany := p.Count > 0 && i >= p.Count
+			if tooOld || tooMany {
+				expired = append(expired, r)
+			}
+		}
+	}
+	sort.Sort(EventResults(expired))
+	return expired
+}
+
+//	Delete event results by retention policy when execute metronome with gc subcommand
+//	When dryRun is true, only print event results that would be deleted
+func CollectGarbage(w io.Writer, dryRun bool) error {
+	results, err := getEventResults()
+	if err != nil {
+		return err
+	}
+
+	policy := retentionPolicy()
+	expired := policy.expired(results, time.Now())
+	for _, r := range expired {
+		if dryRun {
+			fmt.Fprintf(w, "Would delete event %s(Name: %s, Status: %s, StartedAt: %s)\n", r.ID, r.Name, r.Status, r.StartedAt.Format(time.RFC3339))
+			continue
+		}
+		if err := markExecuted(r.ID); err != nil {
+			return err
+		}
+		if err := deleteEventResult(r.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Deleted event %s(Name: %s, Status: %s, StartedAt: %s)\n", r.ID, r.Name, r.Status, r.StartedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "%d of %d event results are expired\n", len(expired), len(results))
+
+	keys, err := auditKeys()
+	if err != nil {
+		return err
+	}
+	expiredAudit := policy.expiredAudit(keys, time.Now())
+	if dryRun {
+		fmt.Fprintf(w, "Would delete %d of %d audit records\n", len(expiredAudit), len(keys))
+		return nil
+	}
+	for _, k := range expiredAudit {
+		if _, err := util.Consul().KV().Delete(k, &api.WriteOptions{}); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "%d of %d audit records are expired\n", len(expiredAudit), len(keys))
+
+	pruned, err := pruneTombstones(time.Now())
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		fmt.Fprintf(w, "Deleted %d tombstones of events that have left event buffer of consul\n", pruned)
+	}
+	return nil
+}
+
+//	Record ID of event whose result is deleted to keep it from being dispatched again
+//	Consul passes all events in its buffer to push subcommand each time, and result of event was only guard against them
+func markExecuted(id string) error {
+	kv := &api.KVPair{
+		Key:   EXECUTED_EVENT_KEY + "/" + id,
+		Value: []byte(time.Now().Format(time.RFC3339)),
+	}
+	_, err := util.Consul().KV().Put(kv, &api.WriteOptions{})
+	return err
+}
+
+//	Return true when event has been executed and its result has been deleted
+func isExecuted(id string) (bool, error) {
+	kv, _, err := util.Consul().KV().Get(EXECUTED_EVENT_KEY+"/"+id, &api.QueryOptions{})
+	if err != nil {
+		return false, err
+	}
+	return kv != nil, nil
+}
+
+//	Return true when event has result or tombstone, that is, it has already left event queue
+func isHandled(id string) (bool, error) {
+	result, err := getEventResult(id)
+	if _, ok := err.(*InvalidResultError); ok {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if result != nil {
+		return true, nil
+	}
+	return isExecuted(id)
+}
+
+//	Delete tombstones of events that are no longer in event buffer of consul agent
+func pruneTombstones(now time.Time) (int, error) {
+	events, _, err := util.Consul().Event().List("", &api.QueryOptions{})
+	if err != nil {
+		return 0, err
+	}
+	buffered := make(map[string]bool)
+	for _, e := range events {
+		buffered[e.ID] = true
+	}
+
+	kvs, _, err := util.Consul().KV().List(EXECUTED_EVENT_KEY+"/", &api.QueryOptions{})
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, kv := range kvs {
+		id := strings.TrimPrefix(kv.Key, EXECUTED_EVENT_KEY+"/")
+		deletedAt, err := time.Parse(time.RFC3339, string(kv.Value))
+		if buffered[id] || err == nil && now.Sub(deletedAt) < TOMBSTONE_MIN_AGE {
+			continue
+		}
+		if _, err := util.Consul().KV().Delete(kv.Key, &api.WriteOptions{}); err != nil {
+			return pruned, err
+		}
+		pruned += 1
+	}
+	return pruned, nil
+}
+
+//	Delete expired event results periodically on the node that has been elected as leader
+func (s *Scheduler) collectGarbagePeriodically() {
+	if config.GCInterval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.GCInterval) * time.Minute)
+
+		var b bytes.Buffer
+		elected, err := runAsLeader(func() error {
+			return CollectGarbage(&b, false)
+		})
+		if b.Len() > 0 {
+			log.Info(strings.TrimSpace(b.String()))
+		}
+		if err != nil {
+			log.Errorf("Failed to delete expired event results(%s)", err)
+			continue
+		}
+		if !elected {
+			log.Debug("Skip deleting expired event results because other node has been elected")
+		}
+	}
+}
+
+//	Execute function only when this node can acquire leader lock without waiting
+func runAsLeader(f func() error) (bool, error) {
+	l, err := util.Consul().LockOpts(&api.LockOptions{
+		Key:          LEADER_LOCK_KEY,
+		LockTryOnce:  true,
+		LockWaitTime: 1 * time.Second,
+	})
+	if err != nil {
+		return false, err
+	}
+	ch, err := l.Lock(nil)
+	if err != nil {
+		return false, err
+	}
+	if ch == nil {
+		return false, nil
+	}
+	defer l.Unlock()
+
+	return true, f()
+}
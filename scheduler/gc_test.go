@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	result := func(id string, name string, status string, daysAgo int, finished bool) EventResult {
+		r := EventResult{ID: id, Name: name, Status: status, StartedAt: now.AddDate(0, 0, -daysAgo)}
+		if finished {
+			r.FinishedAt = r.StartedAt.Add(time.Minute)
+		}
+		return r
+	}
+	results := []EventResult{
+		result("d1", "deploy", "success", 1, true),
+		result("d2", "deploy", "error", 2, true),
+		result("d3", "deploy", "success", 3, true),
+		result("d4", "deploy", "error", 4, true),
+		result("d5", "deploy", "inprogress", 5, false),
+		result("b1", "backup", "success", 10, true),
+		result("b2", "backup", "timeout", 20, true),
+	}
+
+	cases := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{"keep all", RetentionPolicy{}, nil},
+		{"age", RetentionPolicy{Age: 3 * 24 * time.Hour}, []string{"b2", "b1", "d4"}},
+		{"count", RetentionPolicy{Count: 2}, []string{"d4", "d3"}},
+		{"count and age", RetentionPolicy{Age: 15 * 24 * time.Hour, Count: 3}, []string{"b2", "d4"}},
+		{"keep failed", RetentionPolicy{Count: 1, KeepFailed: 1}, []string{"d4", "d3"}},
+		{"keep failed with age", RetentionPolicy{Age: 24 * time.Hour, KeepFailed: 2}, []string{"b1", "d3"}},
+		{"unfinished", RetentionPolicy{Age: time.Hour, Count: 1, KeepFailed: 0}, []string{"b2", "b1", "d4", "d3", "d2", "d1"}},
+	}
+	for _, c := range cases {
+		var actual []string
+		for _, r := range c.policy.expired(results, now) {
+			actual = append(actual, r.ID)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: expired() = %v, want %v", c.name, actual, c.expected)
+		}
+	}
+}
+
+func TestRetentionPolicyExpiredAudit(t *testing.T) {
+	now := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	key := func(daysAgo int) string {
+		return fmt.Sprintf("%s/%020d-node1", AUDIT_KEY, now.AddDate(0, 0, -daysAgo).UnixNano())
+	}
+	keys := []string{key(40), key(31), key(29), key(1), AUDIT_KEY + "/invalid"}
+
+	cases := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{"keep all", RetentionPolicy{}, nil},
+		{"30 days", RetentionPolicy{AuditAge: 30 * 24 * time.Hour}, []string{key(40), key(31)}},
+		{"1 hour", RetentionPolicy{AuditAge: time.Hour}, []string{key(40), key(31), key(29), key(1)}},
+	}
+	for _, c := range cases {
+		actual := c.policy.expiredAudit(keys, now)
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: expiredAudit() = %v, want %v", c.name, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"metronome/task"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//	Results of event with all tasks and nodes
+type EventDetail struct {
+	Event EventResult
+	Tasks []TaskDetail
+}
+
+//	Result of task with results on all nodes
+type TaskDetail struct {
+	Task  TaskResult
+	Nodes []NodeTaskResult
+}
+
+//	Return recent event results in newest first order that are filtered by name and status
+func History(name string, status string, limit int) ([]EventResult, error) {
+	results, err := getEventResults()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(EventResults(results)))
+
+	var filtered []EventResult
+	for _, r := range results {
+		if name != "" && r.Name != name {
+			continue
+		}
+		if status != "" && r.Status != status {
+			continue
+		}
+		filtered = append(filtered, r)
+		if limit > 0 && len(filtered) >= limit {
+			break
+		}
+	}
+	return filtered, nil
+}
+
+//	Return results of event with all tasks and nodes
+func GetEventDetail(id string) (*EventDetail, error) {
+	return getEventDetail(id, true)
+}
+
+//	Return results of event with all tasks and nodes without logs, to poll progress cheaply
+func GetEventSummary(id string) (*EventDetail, error) {
+	return getEventDetail(id, false)
+}
+
+func getEventDetail(id string, withLog bool) (*EventDetail, error) {
+	eventResult, err := getEventResult(id)
+	if err != nil {
+		return nil, err
+	}
+	if eventResult == nil {
+		return nil, errors.New(fmt.Sprintf("Event %s is not found", id))
+	}
+
+	detail := &EventDetail{Event: *eventResult}
+	taskResults, err := getTaskResults(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, tr := range taskResults {
+		nodeResults, err := tr.getNodeResults(withLog)
+		if err != nil {
+			return nil, err
+		}
+		detail.Tasks = append(detail.Tasks, TaskDetail{Task: tr, Nodes: nodeResults})
+	}
+	return detail, nil
+}
+
+//	Print event results as table
+func PrintHistory(w io.Writer, results []EventResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tSTARTED\tDURATION")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.Name, r.Status, formatTime(r.StartedAt), duration(r.StartedAt, r.FinishedAt))
+	}
+	tw.Flush()
+}
+
+//	Format arguments of task as "key1=value1, key2=value2" in sorted order
+func formatArguments(args map[string]string) string {
+	var keys []string
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var items []string
+	for _, k := range keys {
+		items = append(items, fmt.Sprintf("%s=%s", k, args[k]))
+	}
+	return strings.Join(items, ", ")
+}
+
+//	Print matrix of task and node with durations and failure reasons
+func PrintEventDetail(w io.Writer, detail *EventDetail) {
+	e := detail.Event
+	fmt.Fprintf(w, "Event:    %s(%s)\n", e.ID, e.Name)
+	fmt.Fprintf(w, "Status:   %s\n", e.Status)
+	fmt.Fprintf(w, "Started:  %s\n", formatTime(e.StartedAt))
+	fmt.Fprintf(w, "Duration: %s\n\n", duration(e.StartedAt, e.FinishedAt))
+
+	//	Collect node names over all tasks for columns
+	var nodes []string
+	found := make(map[string]bool)
+	for _, t := range detail.Tasks {
+		for _, n := range t.Nodes {
+			if !found[n.Node] {
+				found[n.Node] = true
+				nodes = append(nodes, n.Node)
+			}
+		}
+	}
+	sort.Strings(nodes)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "NO\tTASK\tSTATUS\tDURATION\t%s\n", strings.Join(nodes, "\t"))
+	var failures []string
+	for _, t := range detail.Tasks {
+		var cells []string
+		for _, node := range nodes {
+			cell := "-"
+			for _, n := range t.Nodes {
+				if n.Node != node {
+					continue
+				}
+				cell = fmt.Sprintf("%s(%s)", n.Status, duration(n.StartedAt, n.FinishedAt))
+				if n.Status == "error" {
+					failures = append(failures, fmt.Sprintf("  Task %d(%s) on %s: %s", t.Task.No, t.Task.Name, n.Node, failureReason(n)))
+					failures = append(failures, operationLines(n.Operations)...)
+				}
+			}
+			cells = append(cells, cell)
+		}
+		name := t.Task.Name
+		if len(t.Task.Arguments) > 0 {
+			name += "(" + formatArguments(t.Task.Arguments) + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", t.Task.No, name, t.Task.Status, duration(t.Task.StartedAt, t.Task.FinishedAt), strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+
+	if len(failures) > 0 {
+		fmt.Fprintf(w, "\nFailures:\n%s\n", strings.Join(failures, "\n"))
+	}
+	fmt.Fprintf(w, "\nRun `metronome logs %s [--task N] [--node X]` to view logs\n", e.ID)
+}
+
+//	Return error message in result, or last error message in log of node written by old agent
+func failureReason(r NodeTaskResult) string {
+	if r.Error != "" {
+		if r.ExitCode != 0 {
+			return fmt.Sprintf("%s(exit code %d)", r.Error, r.ExitCode)
+		}
+		return r.Error
+	}
+	lines := strings.Split(strings.TrimSpace(r.Log), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.Contains(lines[i], "[ERROR]") {
+			return strings.TrimSpace(lines[i][strings.Index(lines[i], "[ERROR]")+len("[ERROR]"):])
+		}
+	}
+	return "unknown"
+}
+
+//	Return status of each operation with last line of STDERR on failed operation
+func operationLines(operations []task.OperationResult) []string {
+	var lines []string
+	for _, o := range operations {
+		line := fmt.Sprintf("    #%d %-8s %s(%s)", o.Index, o.Status, o.Description, duration(o.StartedAt, o.FinishedAt))
+		if o.ExitCode != 0 {
+			line += fmt.Sprintf(" exit code %d", o.ExitCode)
+		}
+		lines = append(lines, line)
+
+		if o.Status == "error" || o.Status == "timeout" {
+			output := strings.TrimSpace(o.Stderr)
+			if output == "" {
+				output = strings.TrimSpace(o.Stdout)
+			}
+			if output != "" {
+				outputs := strings.Split(output, "\n")
+				lines = append(lines, "      "+outputs[len(outputs)-1])
+			}
+		}
+	}
+	return lines
+}
+
+func duration(started time.Time, finished time.Time) string {
+	if started.IsZero() {
+		return "-"
+	}
+	if finished.IsZero() {
+		finished = time.Now()
+	}
+	return (finished.Sub(started) / time.Second * time.Second).String()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,442 @@
+package scheduler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"metronome/config"
+	"metronome/util"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+)
+
+const LOG_FLUSH_INTERVAL = 2 * time.Second
+const LOG_FOLLOW_WAIT_TIME = 10 * time.Second
+const LOG_CHUNK_SIZE = 256 * 1024
+const LOG_ENCODING = "gzip"
+const TASK_LOG_CLEAN_INTERVAL = 1 * time.Hour
+
+//	Index of log that is stored as compressed chunks under [NodeTaskResult]/log/
+//	Chunks are split from a single gzip stream to keep each value under limit of consul KVS
+//	Head is bytes that are kept before truncated part to align log with streamed log
+type logIndex struct {
+	Encoding  string
+	Size      int
+	Chunks    int
+	Head      int `json:",omitempty"`
+	Truncated int
+}
+
+//	Position in log of a node that has been printed by logs subcommand
+type logCursor struct {
+	seq     int
+	offset  int
+	partial string
+}
+
+//	Flush captured log of running task to consul KVS periodically
+//	Each flush writes log that has been captured after previous flush as chunks under [NodeTaskResult]/stream
+//	Large log is split by LOG_CHUNK_SIZE to keep each value under limit of consul KVS
+type logStreamer struct {
+	key    string
+	buffer *util.LogBuffer
+	offset int
+	seq    int
+	stop   chan bool
+	done   chan bool
+}
+
+func startLogStreamer(r *NodeTaskResult, b *util.LogBuffer) *logStreamer {
+	ls := &logStreamer{
+		key:    r.Key() + "/stream/",
+		buffer: b,
+		stop:   make(chan bool),
+		done:   make(chan bool),
+	}
+
+	go func() {
+		defer close(ls.done)
+		for {
+			select {
+			case <-ls.stop:
+				ls.flush()
+				return
+			case <-time.After(LOG_FLUSH_INTERVAL):
+				ls.flush()
+			}
+		}
+	}()
+	return ls
+}
+
+func (ls *logStreamer) flush() {
+	s := ls.buffer.String()
+	if ls.offset >= len(s) {
+		return
+	}
+	for _, chunk := range splitChunks([]byte(s[ls.offset:]), LOG_CHUNK_SIZE) {
+		kv := &api.KVPair{
+			Key:   fmt.Sprintf("%s%06d", ls.key, ls.seq),
+			Value: chunk,
+		}
+		if _, err := util.Consul().KV().Put(kv, &api.WriteOptions{}); err != nil {
+			log.Warnf("Failed to flush log to %s(%s)", kv.Key, err)
+			return
+		}
+		ls.offset += len(chunk)
+		ls.seq += 1
+	}
+}
+
+//	Split data into chunks that don't exceed size
+func splitChunks(d []byte, size int) [][]byte {
+	var chunks [][]byte
+	for offset := 0; offset < len(d); offset += size {
+		end := offset + size
+		if end > len(d) {
+			end = len(d)
+		}
+		chunks = append(chunks, d[offset:end])
+	}
+	return chunks
+}
+
+//	Stop flushing after remaining log has been flushed
+func (ls *logStreamer) Stop() {
+	close(ls.stop)
+	<-ls.done
+}
+
+//	Delete chunks after entire log has been saved with NodeTaskResult
+func (ls *logStreamer) Clear() error {
+	_, err := util.Consul().KV().DeleteTree(ls.key, &api.WriteOptions{})
+	return err
+}
+
+//	Save log as compressed chunks and index
+func saveLog(key string, text string) error {
+	prev, err := getLogIndex(key)
+	if err != nil {
+		return err
+	}
+
+	text, head, truncated := truncateLog(text, config.LogMaxSize)
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(text)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	//	Write chunks before index because reader depends on index
+	d := b.Bytes()
+	index := &logIndex{Encoding: LOG_ENCODING, Size: len(text), Head: head, Truncated: truncated}
+	for _, chunk := range splitChunks(d, LOG_CHUNK_SIZE) {
+		kv := &api.KVPair{
+			Key:   fmt.Sprintf("%s/%06d", key, index.Chunks),
+			Value: chunk,
+		}
+		if _, err := util.Consul().KV().Put(kv, &api.WriteOptions{}); err != nil {
+			return err
+		}
+		index.Chunks += 1
+	}
+
+	v, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if _, err := util.Consul().KV().Put(&api.KVPair{Key: key + "/index", Value: v}, &api.WriteOptions{}); err != nil {
+		return err
+	}
+
+	//	Remove stale chunks that previous log had written
+	if prev != nil {
+		for i := index.Chunks; i < prev.Chunks; i++ {
+			if _, err := util.Consul().KV().Delete(fmt.Sprintf("%s/%06d", key, i), &api.WriteOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//	Load log from compressed chunks, or from a single value which has been written by older version
+func loadLog(key string) (string, error) {
+	index, err := getLogIndex(key)
+	if err != nil {
+		return "", err
+	}
+	if index == nil {
+		kv, _, err := util.Consul().KV().Get(key, &api.QueryOptions{})
+		if err != nil || kv == nil {
+			return "", err
+		}
+		return string(kv.Value), nil
+	}
+
+	var b bytes.Buffer
+	for i := 0; i < index.Chunks; i++ {
+		kv, _, err := util.Consul().KV().Get(fmt.Sprintf("%s/%06d", key, i), &api.QueryOptions{})
+		if err != nil {
+			return "", err
+		}
+		if kv == nil {
+			return "", errors.New(fmt.Sprintf("Chunk %d of %s is missing", i, key))
+		}
+		b.Write(kv.Value)
+	}
+	if b.Len() == 0 {
+		return "", nil
+	}
+
+	r, err := gzip.NewReader(&b)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(d), nil
+}
+
+func getLogIndex(key string) (*logIndex, error) {
+	kv, _, err := util.Consul().KV().Get(key+"/index", &api.QueryOptions{})
+	if err != nil || kv == nil {
+		return nil, err
+	}
+	var index logIndex
+	if err := json.Unmarshal(kv.Value, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+//	Truncate middle of log and keep head and tail when log exceeds max size
+//	It returns bytes of head and truncated part, and both ends of truncated part are on boundaries of UTF-8 characters
+func truncateLog(text string, max int) (string, int, int) {
+	if max <= 0 || len(text) <= max {
+		return text, len(text), 0
+	}
+	head := max / 2
+	for head > 0 && !utf8.RuneStart(text[head]) {
+		head--
+	}
+	tail := len(text) - (max - max/2)
+	for tail < len(text) && !utf8.RuneStart(text[tail]) {
+		tail++
+	}
+	truncated := tail - head
+	return text[:head] + truncatedMarker(truncated) + text[tail:], head, truncated
+}
+
+func truncatedMarker(truncated int) string {
+	return fmt.Sprintf("\n... %d bytes truncated ...\n", truncated)
+}
+
+//	Return part of saved log after offset in original log, and length of original log
+//	Truncated part is replaced with marker when offset is before it
+func remainingLog(text string, index *logIndex, offset int) (string, int) {
+	if index == nil || index.Truncated == 0 || index.Head+len(truncatedMarker(index.Truncated)) > len(text) {
+		if offset > len(text) {
+			return "", len(text)
+		}
+		return text[offset:], len(text)
+	}
+
+	head := index.Head
+	marker := truncatedMarker(index.Truncated)
+	tail := text[head+len(marker):]
+	total := head + index.Truncated + len(tail)
+	switch {
+	case offset <= head:
+		return text[offset:], total
+	case offset <= head+index.Truncated:
+		return marker + tail, total
+	case offset >= total:
+		return "", total
+	default:
+		return tail[offset-head-index.Truncated:], total
+	}
+}
+
+//	Return log of node after cursor and advance cursor
+//	Log of running task is read from chunks that have been flushed, and log of finished task is read from saved log
+func readNodeLog(id string, no int, node string, c *logCursor) (string, bool, error) {
+	result, err := getNodeTaskResult(id, no, node)
+	if err != nil || result == nil {
+		return "", false, err
+	}
+	if result.IsFinished() {
+		index, err := getLogIndex(result.Key() + "/log")
+		if err != nil {
+			return "", false, err
+		}
+		text, total := remainingLog(result.Log, index, c.offset)
+		c.offset = total
+		return text, true, nil
+	}
+
+	kvs, _, err := util.Consul().KV().List(result.Key()+"/stream/", &api.QueryOptions{})
+	if err != nil {
+		return "", false, err
+	}
+	var b bytes.Buffer
+	for _, kv := range kvs {
+		seq, err := strconv.Atoi(path.Base(kv.Key))
+		if err != nil || seq < c.seq {
+			continue
+		}
+		b.Write(kv.Value)
+		c.seq = seq + 1
+	}
+	c.offset += b.Len()
+	return b.String(), false, nil
+}
+
+//	Print logs of event over all nodes with prefix as each node
+//	When follow is true, wait for new logs until event has finished
+func Logs(w io.Writer, id string, no int, node string, follow bool) error {
+	cursors := make(map[string]*logCursor)
+	var index uint64
+	for {
+		eventResult, err := getEventResult(id)
+		if err != nil {
+			return err
+		}
+		if eventResult == nil {
+			return errors.New(fmt.Sprintf("Event %s is not found", id))
+		}
+
+		taskResults, err := getTaskResults(id)
+		if err != nil {
+			return err
+		}
+
+		//	Node that has timed out or whose agent has died stays inprogress after event has finished,
+		//	so following log stops when event has finished instead of waiting for all nodes
+		finished := !eventResult.FinishedAt.IsZero()
+		for _, tr := range taskResults {
+			if no >= 0 && tr.No != no {
+				continue
+			}
+			nodes, err := childKeys(tr.Key())
+			if err != nil {
+				return err
+			}
+			for _, n := range nodes {
+				if node != "" && n != node {
+					continue
+				}
+				label := fmt.Sprintf("%d:%s %s", tr.No, tr.Name, n)
+				c, found := cursors[label]
+				if !found {
+					c = &logCursor{}
+					cursors[label] = c
+				}
+				text, done, err := readNodeLog(id, tr.No, n, c)
+				if err != nil {
+					return err
+				}
+
+				//	Keep incomplete line of running task until rest of it has been flushed
+				text = c.partial + text
+				c.partial = ""
+				if follow && !done && !finished {
+					i := strings.LastIndex(text, "\n")
+					c.partial = text[i+1:]
+					text = text[:i+1]
+				}
+				if text != "" {
+					printLines(w, label, text)
+				}
+			}
+		}
+
+		if !follow || finished {
+			return nil
+		}
+
+		//	Wait until any result of event has been changed
+		_, meta, err := util.Consul().KV().Keys(eventResult.Key(), "", &api.QueryOptions{WaitIndex: index, WaitTime: LOG_FOLLOW_WAIT_TIME})
+		if err != nil {
+			return err
+		}
+		index = meta.LastIndex
+	}
+}
+
+func printLines(w io.Writer, label string, text string) {
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		fmt.Fprintf(w, "%s | %s\n", label, line)
+	}
+}
+
+//	Write log of task on this node to [TaskLogDir]/[EventID]/[No]-[Task].log
+func writeTaskLogFile(et EventTask, text string) error {
+	if config.TaskLogDir == "" {
+		return nil
+	}
+	dir := filepath.Join(config.TaskLogDir, et.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d-%s.log", et.No, et.Task)), []byte(text), 0644)
+}
+
+//	Delete expired task log files periodically on each node because they are written locally
+//	It runs independently of -gc-interval that only controls event results on consul KVS
+func deleteExpiredTaskLogFilesPeriodically() {
+	if config.TaskLogDir == "" || config.TaskLogRetentionDays <= 0 {
+		return
+	}
+	for {
+		if err := deleteExpiredTaskLogFiles(); err != nil {
+			log.Warnf("Failed to delete expired task log files(%s)", err)
+		}
+		time.Sleep(TASK_LOG_CLEAN_INTERVAL)
+	}
+}
+
+//	Delete directories of events in TaskLogDir that haven't been updated within retention days
+func deleteExpiredTaskLogFiles() error {
+	if config.TaskLogDir == "" || config.TaskLogRetentionDays <= 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(config.TaskLogDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	threshold := time.Now().AddDate(0, 0, -config.TaskLogRetentionDays)
+	for _, e := range entries {
+		//	Skip files such as agent log that may be written in same directory
+		if !e.IsDir() || e.ModTime().After(threshold) {
+			continue
+		}
+		log.Infof("Delete expired task log files(%s)", e.Name())
+		if err := os.RemoveAll(filepath.Join(config.TaskLogDir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
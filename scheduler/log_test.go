@@ -0,0 +1,224 @@
+package scheduler
+
+import (
+	"bytes"
+	"math/rand"
+	"metronome/util"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestLogs(t *testing.T) {
+	startFakeConsul()
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	save := func(r interface {
+		Save() error
+	}) {
+		if err := r.Save(); err != nil {
+			t.Fatalf("Save() returns error: %s", err)
+		}
+	}
+	save(&EventResult{ID: "1", Name: "deploy", Status: "inprogress", StartedAt: started})
+	save(&TaskResult{EventID: "1", No: 0, Name: "build", Status: "success", StartedAt: started})
+	save(&TaskResult{EventID: "1", No: 1, Name: "restart", Status: "inprogress", StartedAt: started})
+	save(&NodeTaskResult{EventID: "1", No: 0, Node: "node1", Status: "success", Log: "build\ndone\n", StartedAt: started, FinishedAt: started})
+	save(&NodeTaskResult{EventID: "1", No: 1, Node: "node1", Status: "success", Log: "restarted\n", StartedAt: started, FinishedAt: started})
+
+	//	Log of running task is read from chunks that have been flushed
+	running := &NodeTaskResult{EventID: "1", No: 1, Node: "node2", Status: "inprogress", StartedAt: started}
+	save(running)
+	var b util.LogBuffer
+	b.Write([]byte("restarting\n"))
+	startLogStreamer(running, &b).Stop()
+
+	cases := []struct {
+		name     string
+		no       int
+		node     string
+		expected string
+	}{
+		{"all", -1, "", "0:build node1 | build\n0:build node1 | done\n1:restart node1 | restarted\n1:restart node2 | restarting\n"},
+		{"task", 1, "", "1:restart node1 | restarted\n1:restart node2 | restarting\n"},
+		{"node", -1, "node2", "1:restart node2 | restarting\n"},
+		{"no logs", 2, "", ""},
+	}
+	for _, c := range cases {
+		var w bytes.Buffer
+		if err := Logs(&w, "1", c.no, c.node, false); err != nil {
+			t.Errorf("%s: Logs() returns error: %s", c.name, err)
+			continue
+		}
+		if w.String() != c.expected {
+			t.Errorf("%s: Logs() = %q, want %q", c.name, w.String(), c.expected)
+		}
+	}
+
+	if err := Logs(&bytes.Buffer{}, "2", -1, "", false); err == nil {
+		t.Errorf("Logs() doesn't return error for unknown event")
+	}
+}
+
+func TestLogsFollowTimedOutNode(t *testing.T) {
+	startFakeConsul()
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	(&EventResult{ID: "1", Name: "deploy", Status: "timeout", StartedAt: started, FinishedAt: started}).Save()
+	(&TaskResult{EventID: "1", No: 0, Name: "restart", Status: "timeout", StartedAt: started, FinishedAt: started}).Save()
+
+	//	Node has timed out and never finishes its result and log
+	running := &NodeTaskResult{EventID: "1", No: 0, Node: "node1", Status: "inprogress", StartedAt: started}
+	running.Save()
+	var b util.LogBuffer
+	b.Write([]byte("restarting\nwaiting"))
+	startLogStreamer(running, &b).Stop()
+
+	var w bytes.Buffer
+	errs := make(chan error, 1)
+	go func() { errs <- Logs(&w, "1", -1, "", true) }()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Logs() returns error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Logs() keeps following event that has finished")
+	}
+
+	expected := "0:restart node1 | restarting\n0:restart node1 | waiting\n"
+	if w.String() != expected {
+		t.Errorf("Logs() = %q, want %q", w.String(), expected)
+	}
+}
+
+func TestTruncateLog(t *testing.T) {
+	cases := []struct {
+		name      string
+		text      string
+		max       int
+		expected  string
+		head      int
+		truncated int
+	}{
+		{"unlimited", "abcdefghij", 0, "abcdefghij", 10, 0},
+		{"short", "abcdefghij", 10, "abcdefghij", 10, 0},
+		{"ascii", "abcdefghij", 4, "ab" + truncatedMarker(6) + "ij", 2, 6},
+		{"odd max", "abcdefghij", 5, "ab" + truncatedMarker(5) + "hij", 2, 5},
+		{"multibyte", "あいうえお", 7, "あ" + truncatedMarker(9) + "お", 3, 9},
+		{"multibyte head", "aあいうえお", 6, "a" + truncatedMarker(12) + "お", 1, 12},
+		{"multibyte tail", "あいうえおa", 8, "あ" + truncatedMarker(9) + "おa", 3, 9},
+	}
+	for _, c := range cases {
+		actual, head, truncated := truncateLog(c.text, c.max)
+		if actual != c.expected || head != c.head || truncated != c.truncated {
+			t.Errorf("%s: truncateLog() = (%q, %d, %d), want (%q, %d, %d)", c.name, actual, head, truncated, c.expected, c.head, c.truncated)
+		}
+		if !utf8.ValidString(actual) {
+			t.Errorf("%s: truncateLog() = %q isn't valid UTF-8", c.name, actual)
+		}
+	}
+}
+
+func TestSaveLog(t *testing.T) {
+	consul := startFakeConsul()
+	key := "metronome/results/1/0/node1/log"
+
+	//	Random bytes can't be compressed, so they are split into multiple chunks
+	random := make([]byte, LOG_CHUNK_SIZE*2+1)
+	rand.New(rand.NewSource(1)).Read(random)
+	large := string(random)
+
+	cases := []struct {
+		name   string
+		text   string
+		chunks int
+	}{
+		{"empty", "", 1},
+		{"small", "hello\nworld\n", 1},
+		{"large", large, 3},
+		{"stale chunks are removed", "hello\n", 1},
+	}
+	for _, c := range cases {
+		if err := saveLog(key, c.text); err != nil {
+			t.Errorf("%s: saveLog() returns error: %s", c.name, err)
+			continue
+		}
+		actual, err := loadLog(key)
+		if err != nil {
+			t.Errorf("%s: loadLog() returns error: %s", c.name, err)
+			continue
+		}
+		if actual != c.text {
+			t.Errorf("%s: loadLog() returns %d bytes, want %d bytes", c.name, len(actual), len(c.text))
+		}
+		index, _ := getLogIndex(key)
+		if chunks := len(consul.keys(key + "/0")); index == nil || index.Chunks != c.chunks || chunks != c.chunks {
+			t.Errorf("%s: saveLog() writes %d chunks with index %v, want %d chunks", c.name, chunks, index, c.chunks)
+		}
+	}
+
+	//	Log that has been written by older version is a single value
+	legacy := "metronome/results/1/0/node2/log"
+	consul.put(legacy, "legacy\n")
+	if actual, err := loadLog(legacy); err != nil || actual != "legacy\n" {
+		t.Errorf("loadLog() = (%q, %v), want %q", actual, err, "legacy\n")
+	}
+}
+
+func TestRemainingLog(t *testing.T) {
+	original := "0123456789abcdefghij"
+	saved, head, truncated := truncateLog(original, 8)
+	index := &logIndex{Head: head, Truncated: truncated}
+	marker := truncatedMarker(truncated)
+
+	cases := []struct {
+		name     string
+		text     string
+		index    *logIndex
+		offset   int
+		expected string
+	}{
+		{"without index", original, nil, 5, original[5:]},
+		{"offset over end", original, nil, 30, ""},
+		{"not truncated", original, &logIndex{}, 0, original},
+		{"from beginning", saved, index, 0, saved},
+		{"in head", saved, index, 2, saved[2:]},
+		{"end of head", saved, index, 4, marker + "ghij"},
+		{"in truncated part", saved, index, 10, marker + "ghij"},
+		{"in tail", saved, index, 18, "ij"},
+		{"end", saved, index, 20, ""},
+	}
+	for _, c := range cases {
+		actual, total := remainingLog(c.text, c.index, c.offset)
+		if actual != c.expected {
+			t.Errorf("%s: remainingLog() = %q, want %q", c.name, actual, c.expected)
+		}
+		if total != len(original) {
+			t.Errorf("%s: remainingLog() returns total %d, want %d", c.name, total, len(original))
+		}
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	cases := []struct {
+		text     string
+		size     int
+		expected []string
+	}{
+		{"", 4, nil},
+		{"abc", 4, []string{"abc"}},
+		{"abcd", 4, []string{"abcd"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{strings.Repeat("x", 9), 3, []string{"xxx", "xxx", "xxx"}},
+	}
+	for _, c := range cases {
+		var actual []string
+		for _, chunk := range splitChunks([]byte(c.text), c.size) {
+			actual = append(actual, string(chunk))
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("splitChunks(%q, %d) = %q, want %q", c.text, c.size, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"metronome/metrics"
+	"metronome/queue"
+	"metronome/util"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+)
+
+var (
+	eventsDispatched = metrics.NewCounter("metronome_events_dispatched_total", "Number of events dispatched to progress task queue.", "name")
+	eventsFinished   = metrics.NewCounter("metronome_events_finished_total", "Number of finished events by status(success, error, timeout, cancelled).", "name", "status")
+	taskDuration     = metrics.NewHistogram("metronome_task_duration_seconds", "Duration of task on this node.", metrics.DefaultBuckets, "pattern", "task", "status")
+	lockLatency      = metrics.NewHistogram("metronome_lock_acquisition_seconds", "Latency to acquire consul lock of critical section.", []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}, "key")
+)
+
+func init() {
+	metrics.NewGaugeFunc("metronome_queue_depth", "Number of items in queue.", collectQueueDepths, "queue")
+	metrics.NewGaugeFunc("metronome_progress_queue_head_age_seconds", "Seconds since head of progress task queue has changed.", collectProgressHeadAge)
+}
+
+//	Head of progress task queue that has been observed lastly by this agent
+var progressHead struct {
+	sync.Mutex
+	id        string
+	no        int
+	changedAt time.Time
+}
+
+//	Record time when head of progress task queue has changed
+func observeProgressHead(et EventTask) {
+	progressHead.Lock()
+	defer progressHead.Unlock()
+	if progressHead.changedAt.IsZero() || progressHead.id != et.ID || progressHead.no != et.No {
+		progressHead.id = et.ID
+		progressHead.no = et.No
+		progressHead.changedAt = time.Now()
+	}
+}
+
+func collectProgressHeadAge() []metrics.Sample {
+	progressHead.Lock()
+	defer progressHead.Unlock()
+	if progressHead.changedAt.IsZero() {
+		return nil
+	}
+	return []metrics.Sample{{Value: time.Since(progressHead.changedAt).Seconds()}}
+}
+
+func collectQueueDepths() []metrics.Sample {
+	var samples []metrics.Sample
+	for _, name := range []string{"event", "progress"} {
+		q := &queue.Queue{
+			Client: util.Consul(),
+			Key:    EVENT_QUEUE_KEY,
+		}
+		if name == "progress" {
+			q.Key = PROGRESS_QUEUE_KEY
+		}
+		var items []json.RawMessage
+		if err := q.Items(&items); err != nil {
+			log.Warnf("Failed to collect depth of %s queue(%s)", name, err)
+			continue
+		}
+		samples = append(samples, metrics.Sample{Values: []string{name}, Value: float64(len(items))})
+	}
+	return samples
+}
+
+//	Acquire consul lock of critical section and record latency
+func lockCriticalSection() (*api.Lock, error) {
+	l, err := util.Consul().LockKey(LOCK_KEY)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	if _, err := l.Lock(nil); err != nil {
+		return nil, err
+	}
+	lockLatency.Observe(time.Since(started).Seconds(), LOCK_KEY)
+	return l, nil
+}
@@ -0,0 +1,265 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"metronome/util"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const NOTIFICATION_RETRY = 3
+const NOTIFICATION_TIMEOUT = 10
+
+//	HTTP webhook that is notified when event or task has finished
+//	Events and Statuses filter notification, and On selects event and/or task(default: event)
+type Notification struct {
+	URL      string
+	Method   string
+	Headers  map[string]string
+	Body     interface{}
+	Events   []string
+	Statuses []string
+	On       []string
+	Retry    *int
+	Timeout  int
+}
+
+//	Record of delivering notification that is stored under event result on consul KVS
+type Delivery struct {
+	EventID  string
+	ID       string
+	URL      string
+	Status   string
+	Attempts []DeliveryAttempt
+}
+
+type DeliveryAttempt struct {
+	At         time.Time
+	StatusCode int
+	Error      string `json:",omitempty"`
+}
+
+//	Default body of notification when body isn't specified in task.yml
+type notificationPayload struct {
+	Event *EventResult
+	Task  *TaskResult `json:",omitempty"`
+}
+
+func (d *Delivery) Key() string {
+	return EVENT_RESULT_KEY + "/" + d.EventID + "/notifications/" + d.ID
+}
+
+func (d *Delivery) Save() error {
+	return putResult(d)
+}
+
+func (n *Notification) setDefault() {
+	if n.Method == "" {
+		n.Method = "POST"
+	}
+	if len(n.On) == 0 {
+		n.On = []string{"event"}
+	}
+	//	Retry is pointer to distinguish retry: 0 from omitted one
+	if n.Retry == nil {
+		retry := NOTIFICATION_RETRY
+		n.Retry = &retry
+	}
+	if n.Timeout == 0 {
+		n.Timeout = NOTIFICATION_TIMEOUT
+	}
+}
+
+func (n *Notification) match(on string, name string, status string) bool {
+	return contains(n.On, on) && (len(n.Events) == 0 || contains(n.Events, name)) && (len(n.Statuses) == 0 || contains(n.Statuses, status))
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+//	Notify finished event to webhooks over all task.yml
+func (s *Scheduler) notifyEvent(r *EventResult) {
+	vars := map[string]string{
+		"event.id":    r.ID,
+		"event.name":  r.Name,
+		"status":      r.Status,
+		"started_at":  r.StartedAt.Format(time.RFC3339),
+		"finished_at": r.FinishedAt.Format(time.RFC3339),
+		"duration":    duration(r.StartedAt, r.FinishedAt),
+	}
+	s.notify("event", "event", r.ID, r.Name, r.Status, vars, notificationPayload{Event: r})
+}
+
+//	Notify finished task to webhooks over all task.yml
+func (s *Scheduler) notifyTask(et EventTask, r *TaskResult) {
+	e, err := getEventResult(et.ID)
+	if err != nil || e == nil {
+		e = &EventResult{ID: et.ID, Name: et.Event}
+	}
+	vars := map[string]string{
+		"event.id":    et.ID,
+		"event.name":  et.Event,
+		"task.name":   et.Task,
+		"task.no":     strconv.Itoa(et.No),
+		"pattern":     et.Pattern,
+		"status":      r.Status,
+		"started_at":  r.StartedAt.Format(time.RFC3339),
+		"finished_at": r.FinishedAt.Format(time.RFC3339),
+		"duration":    duration(r.StartedAt, r.FinishedAt),
+	}
+	s.notify("task", fmt.Sprintf("task%d", et.No), et.ID, et.Event, r.Status, vars, notificationPayload{Event: e, Task: r})
+}
+
+//	Deliver notifications that match condition in background to avoid blocking critical section
+func (s *Scheduler) notify(on string, subject string, id string, name string, status string, vars map[string]string, payload notificationPayload) {
+	schedules := s.current()
+	var patterns []string
+	for k := range schedules {
+		patterns = append(patterns, k)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		schedule := schedules[pattern]
+		for i, n := range schedule.Notifications {
+			if !n.match(on, name, status) {
+				continue
+			}
+
+			//	Variables in task.yml are overwritten by variables of result
+			v := schedule.variables()
+			for k, value := range vars {
+				v[k] = util.Literal(value)
+			}
+
+			d := &Delivery{
+				EventID: id,
+				ID:      fmt.Sprintf("%s-%s-%d", subject, pattern, i),
+				URL:     n.URL,
+				Status:  "inprogress",
+			}
+			go n.deliver(d, v, payload)
+		}
+	}
+}
+
+//	Send request to webhook and retry with exponential backoff until succeeded
+func (n *Notification) deliver(d *Delivery, vars map[string]string, payload notificationPayload) {
+	//	Notification that can't be rendered(undefined variable in strict mode) fails without request
+	fail := func(format string, err error) {
+		log.Errorf(format, n.URL, err)
+		d.Status = "failed"
+		d.Attempts = append(d.Attempts, DeliveryAttempt{At: time.Now(), Error: err.Error()})
+		d.Save()
+	}
+	url, err := util.Render(n.URL, vars)
+	if err != nil {
+		fail("Failed to render url of notification to %s(%s)", err)
+		return
+	}
+	headers := make(map[string]string)
+	for k, v := range n.Headers {
+		if headers[k], err = util.Render(v, vars); err != nil {
+			fail("Failed to render headers of notification to %s(%s)", err)
+			return
+		}
+	}
+	body, err := n.body(vars, payload)
+	if err != nil {
+		fail("Failed to create body of notification to %s(%s)", err)
+		return
+	}
+
+	client := &http.Client{Timeout: time.Duration(n.Timeout) * time.Second}
+	for i := 0; i <= *n.Retry; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<uint(i-1)) * time.Second)
+		}
+
+		attempt := DeliveryAttempt{At: time.Now()}
+		attempt.StatusCode, err = n.send(client, url, headers, body)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		d.Attempts = append(d.Attempts, attempt)
+
+		//	Record each attempt to find out reason of failure
+		d.Status = "delivered"
+		if err != nil {
+			log.Warnf("Failed to notify %s to %s(attempt %d/%d: %s)", d.ID, url, i+1, *n.Retry+1, err)
+			d.Status = "failed"
+		}
+		if err := d.Save(); err != nil {
+			log.Warnf("Failed to record delivery of notification(%s)", err)
+		}
+		if d.Status == "delivered" {
+			log.Infof("Notify %s to %s(%d)", d.ID, url, attempt.StatusCode)
+			return
+		}
+	}
+}
+
+func (n *Notification) send(client *http.Client, url string, headers map[string]string, body []byte) (int, error) {
+	req, err := http.NewRequest(n.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, errors.New(fmt.Sprintf("Webhook has responded %s", res.Status))
+	}
+	return res.StatusCode, nil
+}
+
+//	Escape string to embed it between double quotations in JSON
+func jsonEscape(s string) string {
+	d, err := json.Marshal(s)
+	if err != nil {
+		return s
+	}
+	return string(d[1 : len(d)-1])
+}
+
+//	Render body in task.yml with variables, or marshal results when body isn't specified
+func (n *Notification) body(vars map[string]string, payload notificationPayload) ([]byte, error) {
+	switch body := n.Body.(type) {
+	case nil:
+		return json.Marshal(payload)
+	case string:
+		//	Values are escaped as content of JSON string to keep them from breaking structure of body
+		s, err := util.RenderEscaped(body, vars, jsonEscape)
+		return []byte(s), err
+	default:
+		v, err := util.RenderValue(body, vars)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	}
+}
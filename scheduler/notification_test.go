@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"metronome/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotificationBody(t *testing.T) {
+	vars := map[string]string{"status": "error", "message": `say "hello"` + "\n", "nested": "{{message}}"}
+	cases := []struct {
+		body     interface{}
+		expected string
+	}{
+		{`{"status": "{{status}}"}`, `{"status": "error"}`},
+		{`{"message": "{{message}}"}`, `{"message": "say \"hello\"\n"}`},
+		{`{"message": "{{nested}}"}`, `{"message": "say \"hello\"\n"}`},
+		{`{"message": "{{undefined}}"}`, `{"message": "{{undefined}}"}`},
+		{map[string]interface{}{"message": "{{message}}"}, `{"message":"say \"hello\"\n"}`},
+	}
+	for _, c := range cases {
+		n := &Notification{Body: c.body}
+		actual, err := n.body(vars, notificationPayload{})
+		if err != nil {
+			t.Errorf("body(%#v) returns error: %s", c.body, err)
+			continue
+		}
+		if string(actual) != c.expected {
+			t.Errorf("body(%#v) = %s, want %s", c.body, actual, c.expected)
+		}
+	}
+}
+
+func TestNotificationSetDefault(t *testing.T) {
+	zero := 0
+	five := 5
+	cases := []struct {
+		retry    *int
+		expected int
+	}{
+		{nil, NOTIFICATION_RETRY},
+		{&zero, 0},
+		{&five, 5},
+	}
+	for _, c := range cases {
+		n := &Notification{Retry: c.retry}
+		n.setDefault()
+		if *n.Retry != c.expected {
+			t.Errorf("setDefault() sets retry %d, want %d", *n.Retry, c.expected)
+		}
+	}
+}
+
+func TestNotificationDeliver(t *testing.T) {
+	startFakeConsul()
+	defer func(strict bool) { config.StrictVariables = strict }(config.StrictVariables)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("X-Status"))
+	}))
+	defer server.Close()
+
+	//	Notification that can't be rendered in strict mode fails without request
+	cases := []struct {
+		name     string
+		strict   bool
+		url      string
+		header   string
+		status   string
+		expected []string
+	}{
+		{"rendered", false, server.URL + "/{{status}}", "{{status}}", "delivered", []string{"/error error"}},
+		{"undefined is kept", false, server.URL + "/{{undefined}}", "{{undefined}}", "delivered", []string{"/{{undefined}} {{undefined}}"}},
+		{"undefined url in strict mode", true, server.URL + "/{{undefined}}", "{{status}}", "failed", nil},
+		{"undefined header in strict mode", true, server.URL + "/{{status}}", "{{undefined}}", "failed", nil},
+	}
+	for _, c := range cases {
+		config.StrictVariables = c.strict
+		requests = nil
+		n := &Notification{URL: c.url, Headers: map[string]string{"X-Status": c.header}, Body: "{}"}
+		zero := 0
+		n.Retry = &zero
+		n.setDefault()
+		d := &Delivery{EventID: "1", ID: "event-app-0", URL: n.URL, Status: "inprogress"}
+		n.deliver(d, map[string]string{"status": "error"}, notificationPayload{})
+		if d.Status != c.status || len(d.Attempts) != 1 {
+			t.Errorf("%s: deliver() results %s with %d attempt(s), want %s with 1 attempt", c.name, d.Status, len(d.Attempts), c.status)
+		}
+		if len(requests) != len(c.expected) || (len(requests) > 0 && requests[0] != c.expected[0]) {
+			t.Errorf("%s: deliver() sends %v, want %v", c.name, requests, c.expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//	Payload of consul event
+//	Payload is either ACL token itself or JSON that has token and event parameters
+//	ex. {"token": "XXXX", "params": {"backup_directory": "/tmp/backup"}}
+type Payload struct {
+	Token  string            `json:"token"`
+	Params map[string]string `json:"params"`
+}
+
+func parsePayload(d []byte) Payload {
+	var p Payload
+	if strings.HasPrefix(strings.TrimSpace(string(d)), "{") {
+		if err := json.Unmarshal(d, &p); err == nil {
+			return p
+		}
+	}
+	return Payload{Token: string(d)}
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//	Map path of YAML node(ex. "events.configure.ordered_tasks[1].task") to line number in task.yml
+//	It scans indentation of block style YAML because parser doesn't expose positions
+type yamlLocator struct {
+	lines map[string]int
+}
+
+type yamlScope struct {
+	indent int
+	path   string
+	empty  bool
+	item   bool
+	count  int
+}
+
+var yamlKeyPattern = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^:#'"\s][^:#]*?)\s*:(\s+(.*))?$`)
+
+func newYAMLLocator(d []byte) *yamlLocator {
+	l := &yamlLocator{lines: make(map[string]int)}
+	var stack []*yamlScope
+	blockIndent := -1
+
+	for i, line := range strings.Split(string(d), "\n") {
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		content = strings.TrimRight(content, " \r")
+
+		//	Skip contents of block scalar(| or >) that is indented deeper than its key
+		if blockIndent >= 0 {
+			if content == "" || indent > blockIndent {
+				continue
+			}
+			blockIndent = -1
+		}
+		if content == "" || strings.HasPrefix(content, "#") || content == "---" {
+			continue
+		}
+
+		//	Sequence item belongs to key with empty value at same or shallower indent
+		for content == "-" || strings.HasPrefix(content, "- ") {
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if top.indent < indent || top.indent == indent && !top.item && top.empty {
+					break
+				}
+				stack = stack[:len(stack)-1]
+			}
+			parent := &yamlScope{indent: -1}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			path := fmt.Sprintf("%s[%d]", parent.path, parent.count)
+			parent.count += 1
+			l.add(path, i+1)
+			stack = append(stack, &yamlScope{indent: indent, path: path, item: true})
+
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			indent += len(content) - len(rest)
+			content = rest
+		}
+
+		matches := yamlKeyPattern.FindStringSubmatch(content)
+		if matches == nil {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		key := strings.Trim(matches[1], `"'`)
+		path := key
+		if len(stack) > 0 {
+			path = stack[len(stack)-1].path + "." + key
+		}
+		l.add(path, i+1)
+
+		value := strings.TrimSpace(matches[3])
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockIndent = indent
+		}
+		stack = append(stack, &yamlScope{indent: indent, path: path, empty: value == "" || strings.HasPrefix(value, "#")})
+	}
+	return l
+}
+
+func (l *yamlLocator) add(path string, line int) {
+	if _, found := l.lines[path]; !found {
+		l.lines[path] = line
+	}
+}
+
+//	Return line of node, or line of nearest ancestor when node isn't found
+func (l *yamlLocator) Line(path string) int {
+	if l == nil {
+		return 0
+	}
+	for path != "" {
+		if line, found := l.lines[path]; found {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"testing"
+)
+
+func TestYAMLLocator(t *testing.T) {
+	src := `# comment
+events:
+  configure:
+    ordered_tasks:
+      - task: setup
+        service: web
+      - task: "deploy"
+  "quoted": {}
+
+tasks:
+  setup:
+    description: |
+      text: that looks like key
+      - and item
+    operations:
+    - execute:
+        script: echo
+    - service:
+        name: nginx
+        action: restart
+  deploy:
+    operations:
+      -
+        echo: hello
+`
+	cases := []struct {
+		path     string
+		expected int
+	}{
+		{"events", 2},
+		{"events.configure", 3},
+		{"events.configure.ordered_tasks", 4},
+		{"events.configure.ordered_tasks[0]", 5},
+		{"events.configure.ordered_tasks[0].task", 5},
+		{"events.configure.ordered_tasks[0].service", 6},
+		{"events.configure.ordered_tasks[1].task", 7},
+		{"events.quoted", 8},
+		{"tasks.setup.description", 12},
+		{"tasks.setup.text", 11},
+		{"tasks.setup.operations", 15},
+		{"tasks.setup.operations[0].execute.script", 17},
+		{"tasks.setup.operations[1].service", 18},
+		{"tasks.setup.operations[1].service.action", 20},
+		{"tasks.setup.operations[2]", 15},
+		{"tasks.deploy.operations[0]", 23},
+		{"tasks.deploy.operations[0].echo", 24},
+		{"tasks.unknown.operations", 10},
+		{"unknown", 0},
+		{"", 0},
+	}
+	l := newYAMLLocator([]byte(src))
+	for _, c := range cases {
+		if actual := l.Line(c.path); actual != c.expected {
+			t.Errorf("Line(%q) = %d, want %d", c.path, actual, c.expected)
+		}
+	}
+
+	var nilLocator *yamlLocator
+	if line := nilLocator.Line("events"); line != 0 {
+		t.Errorf("Line of nil locator = %d, want 0", line)
+	}
+}
@@ -14,15 +14,6 @@ import (
 
 //	Push event to event queue when execute metronome from consul
 func Push() (string, error) {
-	l, err := util.Consul().LockKey(LOCK_KEY)
-	if err != nil {
-		return "", err
-	}
-	if _, err := l.Lock(nil); err != nil {
-		return "", err
-	}
-	defer l.Unlock()
-
 	//	Unmarshal STDIN from consul
 	bytes, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
@@ -34,24 +25,50 @@ func Push() (string, error) {
 		return "Following error has occurred while unmarshal STDIN", err
 	}
 
-	//	Enqueue each event to event queue
+	return "", pushEvents(receiveEvents)
+}
+
+//	Enqueue each event to event queue in critical section
+func pushEvents(receiveEvents []api.UserEvent) error {
+	l, err := lockCriticalSection()
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+
 	eq := &queue.Queue{
 		Client: util.Consul(),
 		Key:    EVENT_QUEUE_KEY,
 	}
 	for _, re := range receiveEvents {
 		if err := pushSingleEvent(eq, re); err != nil {
-			return "", err
+			return err
 		}
 	}
-	return "", nil
+	return nil
 }
 
 func pushSingleEvent(eq *queue.Queue, re api.UserEvent) error {
+	//	Consul passes all events in its buffer each time, so ignore events that have already left queue without audit
+	handled, err := isHandled(re.ID)
+	if err != nil {
+		return err
+	}
+	if handled {
+		log.Debugf("Ignore event(ID: %s, Name: %s) already has been handled", re.ID, re.Name)
+		return nil
+	}
+
 	//	Reject received event if it doesn't have correct token in payload
-	if config.Token != "" && string(re.Payload) != config.Token {
+	//	Rejected event is marked as executed to keep it from being recorded again
+	payload := parsePayload(re.Payload)
+	record := AuditRecord{Action: "push", EventID: re.ID, EventName: re.Name, Params: payload.Params}
+	if config.Token != "" && payload.Token != config.Token {
 		log.Warnf("Payload doesn't match ACL token(ID: %s, Name: %s)", re.ID, re.Name)
-		return nil
+		record.Result = "rejected"
+		record.Message = "Payload doesn't match ACL token"
+		audit(record)
+		return markExecuted(re.ID)
 	}
 
 	//	Reject received event if it had occurred already
@@ -62,6 +79,8 @@ func pushSingleEvent(eq *queue.Queue, re api.UserEvent) error {
 	for _, se := range storedEvents {
 		if se.ID == re.ID {
 			log.Infof("Receive event was already registerd in a queue(ID: %s, Name: %s)", re.ID, re.Name)
+			record.Result = "duplicate"
+			audit(record)
 			return nil
 		}
 	}
@@ -72,5 +91,7 @@ func pushSingleEvent(eq *queue.Queue, re api.UserEvent) error {
 	}
 
 	log.Infof("Push event to queue(ID: %s, Name: %s)", re.ID, re.Name)
+	record.Result = "accepted"
+	audit(record)
 	return nil
 }
@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"fmt"
+	"metronome/config"
+	"metronome/metrics"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var reloads = metrics.NewCounter("metronome_schedule_reloads_total", "Number of reloads of task.yml by result(success, error).", "result")
+
+func init() {
+	metrics.NewGaugeFunc("metronome_schedule_last_reload_success", "Whether last reload of task.yml has succeeded(1) or failed(0).", collectLastReloadSuccess)
+	metrics.NewGaugeFunc("metronome_schedule_last_reload_success_timestamp_seconds", "Unix time when task.yml has been loaded successfully lastly.", collectLastReloadTime)
+}
+
+//	Result of last load or reload of schedules on this agent
+var lastReload struct {
+	sync.Mutex
+	failed      bool
+	succeededAt time.Time
+}
+
+func recordReload(err error) {
+	lastReload.Lock()
+	defer lastReload.Unlock()
+	lastReload.failed = err != nil
+	if err == nil {
+		lastReload.succeededAt = time.Now()
+	}
+}
+
+func collectLastReloadSuccess() []metrics.Sample {
+	lastReload.Lock()
+	defer lastReload.Unlock()
+	if lastReload.failed {
+		return []metrics.Sample{{Value: 0}}
+	}
+	return []metrics.Sample{{Value: 1}}
+}
+
+func collectLastReloadTime() []metrics.Sample {
+	lastReload.Lock()
+	defer lastReload.Unlock()
+	if lastReload.succeededAt.IsZero() {
+		return nil
+	}
+	return []metrics.Sample{{Value: float64(lastReload.succeededAt.UnixNano()) / float64(time.Second)}}
+}
+
+//	Reload all task.yml and variables.yml, and replace schedules only when no error has been found in them
+//	Tasks that are running keep definitions that have been loaded when they started
+func (scheduler *Scheduler) Reload() error {
+	err := scheduler.reload()
+	recordReload(err)
+	if err != nil {
+		reloads.Inc("error")
+		log.Errorf("Failed to reload schedules, previous schedules are kept(%s)", err)
+		return err
+	}
+	reloads.Inc("success")
+	log.Info("Schedules have been reloaded")
+	return nil
+}
+
+func (scheduler *Scheduler) reload() error {
+	//	Variables are passed to new schedules instead of global to keep running tasks from reading them
+	vars, err := config.LoadUserVariables()
+	if err != nil {
+		return err
+	}
+	//	Reload is always strict because previous schedules are kept instead
+	schedules, err := loadSchedules(vars, true)
+	if err != nil {
+		return err
+	}
+
+	scheduler.mu.Lock()
+	scheduler.schedules = schedules
+	scheduler.mu.Unlock()
+
+	scheduler.watchTriggers()
+	return nil
+}
+
+//	Reload schedules when any of task.yml, imported files and variables.yml has been changed
+func (scheduler *Scheduler) watchFiles(interval time.Duration, stop <-chan struct{}) {
+	prev := fileStamps(scheduler.watchedFiles())
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+		now := fileStamps(scheduler.watchedFiles())
+		if now == prev {
+			continue
+		}
+		log.Info("Schedule files have been changed")
+		scheduler.Reload()
+
+		//	Imports may have been changed by reload
+		prev = fileStamps(scheduler.watchedFiles())
+	}
+}
+
+//	Return variables.yml, all task.yml and files that are imported by current schedules
+func (scheduler *Scheduler) watchedFiles() []string {
+	paths := append([]string{config.VARIABLES_PATH}, config.Files...)
+
+	var imports []string
+	for _, s := range scheduler.current() {
+		for _, i := range s.Imports {
+			imports = append(imports, s.importPath(i))
+		}
+	}
+	sort.Strings(imports)
+	return append(paths, imports...)
+}
+
+//	Return modification time and size of files to detect changes
+func fileStamps(paths []string) string {
+	var stamps []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			stamps = append(stamps, path+":-")
+			continue
+		}
+		stamps = append(stamps, fmt.Sprintf("%s:%d:%d", path, info.ModTime().UnixNano(), info.Size()))
+	}
+	return strings.Join(stamps, ",")
+}
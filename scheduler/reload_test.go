@@ -0,0 +1,185 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"metronome/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestReload(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{"app": testTaskYAML})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+	path := filepath.Join(dir, "app/task.yml")
+	config.Files = []string{path}
+
+	s := newTestScheduler(t, nil)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload() returns error: %s", err)
+	}
+	if _, found := s.schedules["app"].Tasks["restart"]; !found {
+		t.Errorf("Reload() doesn't load task restart of app: %v", s.schedules)
+	}
+	if v := collectLastReloadSuccess()[0].Value; v != 1 {
+		t.Errorf("metronome_schedule_last_reload_success = %v, want 1", v)
+	}
+
+	//	Broken task.yml doesn't replace schedules that have been loaded
+	prev := s.schedules
+	if err := ioutil.WriteFile(path, []byte("events:\n  deploy:\n    task: undefined\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s(%s)", path, err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Errorf("Reload() doesn't return error for broken task.yml")
+	}
+	if !reflect.DeepEqual(s.schedules, prev) {
+		t.Errorf("Reload() replaces schedules by broken task.yml: %v", s.schedules)
+	}
+	if v := collectLastReloadSuccess()[0].Value; v != 0 {
+		t.Errorf("metronome_schedule_last_reload_success = %v, want 0", v)
+	}
+}
+
+func TestReloadEnvironments(t *testing.T) {
+	src := `environments:
+  METRONOME_TEST_ENV: "{{name}}-$HOME"
+variables:
+  name: first
+tasks:
+  env:
+    operations:
+      - execute:
+          script: "echo value=$METRONOME_TEST_ENV"
+`
+	dir := writeTaskFiles(t, map[string]string{"app": src})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+	path := filepath.Join(dir, "app/task.yml")
+	config.Files = []string{path}
+
+	run := func(s *Scheduler) string {
+		out, err := s.current()["app"].Tasks["env"].Operations[0].Run(log.NewEntry(log.New()), nil)
+		if err != nil {
+			t.Fatalf("Run() returns error: %s", err)
+		}
+		return strings.TrimSpace(out.Stdout)
+	}
+
+	s := newTestScheduler(t, nil)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload() returns error: %s", err)
+	}
+	running := s.current()["app"].Tasks["env"]
+	if actual, expected := run(s), "value=first-"+os.Getenv("HOME"); actual != expected {
+		t.Errorf("Command gets %q, want %q", actual, expected)
+	}
+	if v := os.Getenv("METRONOME_TEST_ENV"); v != "" {
+		t.Errorf("Environment of agent is changed to %q", v)
+	}
+
+	//	Removed environment isn't passed to new tasks, while running task keeps its environment
+	ioutil.WriteFile(path, []byte(strings.Replace(src, "METRONOME_TEST_ENV:", "OTHER:", 1)), 0644)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload() returns error: %s", err)
+	}
+	if actual := run(s); actual != "value=" {
+		t.Errorf("Command gets %q after environment has been removed", actual)
+	}
+	out, _ := running.Operations[0].Run(log.NewEntry(log.New()), nil)
+	if actual := strings.TrimSpace(out.Stdout); !strings.HasPrefix(actual, "value=first-") {
+		t.Errorf("Running task gets %q after reload", actual)
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{"app": testTaskYAML})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+	path := filepath.Join(dir, "app/task.yml")
+	config.Files = []string{path}
+
+	s := newTestScheduler(t, nil)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload() returns error: %s", err)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		s.watchFiles(5*time.Millisecond, stop)
+		close(stopped)
+	}()
+
+	//	Change size of file repeatedly because watcher may take stamps after first change
+	added := testTaskYAML + `  added:
+    operations:
+      - echo: added
+`
+	for i := 0; i < 200; i++ {
+		ioutil.WriteFile(path, []byte(added+strings.Repeat("#\n", i)), 0644)
+		time.Sleep(10 * time.Millisecond)
+		if _, found := s.current()["app"].Tasks["added"]; found {
+			break
+		}
+	}
+	if _, found := s.current()["app"].Tasks["added"]; !found {
+		t.Errorf("watchFiles() doesn't reload changed task.yml")
+	}
+
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("watchFiles() doesn't stop")
+	}
+}
+
+func TestFileStamps(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{"app": testTaskYAML})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app/task.yml")
+	paths := []string{path}
+
+	prev := fileStamps(paths)
+	if fileStamps(paths) != prev {
+		t.Errorf("fileStamps() changes without any changes of files")
+	}
+
+	//	Change of size is detected even if modification time has the same resolution
+	ioutil.WriteFile(path, []byte(testTaskYAML+"\n"), 0644)
+	if fileStamps(paths) == prev {
+		t.Errorf("fileStamps() doesn't change after task.yml has been changed")
+	}
+
+	prev = fileStamps(paths)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Hour))
+	if fileStamps(paths) == prev {
+		t.Errorf("fileStamps() doesn't change after modification time has been changed")
+	}
+
+	prev = fileStamps(paths)
+	os.Remove(path)
+	if fileStamps(paths) == prev {
+		t.Errorf("fileStamps() doesn't change after task.yml has been removed")
+	}
+}
+
+func TestWatchedFiles(t *testing.T) {
+	defer func(files []string) { config.Files = files }(config.Files)
+	config.Files = []string{"/opt/app/task.yml", "/opt/db/task.yml"}
+
+	s := newTestScheduler(t, map[string]string{
+		"app": "imports:\n  - ../shared/task.yml\n  - /etc/metronome/common.yml\n",
+		"db":  testTaskYAML,
+	})
+	expected := []string{config.VARIABLES_PATH, "/opt/app/task.yml", "/opt/db/task.yml", "/etc/metronome/common.yml", "/opt/shared/task.yml"}
+	if actual := s.watchedFiles(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("watchedFiles() = %v, want %v", actual, expected)
+	}
+}
@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+//	Result of event with logs of all nodes for JSON report
+type eventReport struct {
+	Event EventResult
+	Tasks []taskReport
+}
+
+type taskReport struct {
+	Task  TaskResult
+	Nodes []nodeTaskResultDetail
+}
+
+//	Write results of event as report with specified format(junit / json)
+func WriteReport(w io.Writer, detail *EventDetail, format string) error {
+	switch format {
+	case "junit", "xml":
+		return writeJUnitReport(w, detail)
+	case "json":
+		return writeJSONReport(w, detail)
+	default:
+		return errors.New(fmt.Sprintf("Unknown report format(%s), it must be junit or json", format))
+	}
+}
+
+//	Return report format from extension of path
+func ReportFormat(path string) string {
+	if strings.HasSuffix(path, ".json") {
+		return "json"
+	}
+	return "junit"
+}
+
+//	Map each task to testsuite and result of each node to testcase
+func writeJUnitReport(w io.Writer, detail *EventDetail) error {
+	suites := junitTestSuites{
+		Name: fmt.Sprintf("%s(%s)", detail.Event.Name, detail.Event.ID),
+		Time: elapsed(detail.Event.StartedAt, detail.Event.FinishedAt),
+	}
+
+	for _, t := range detail.Tasks {
+		suite := junitTestSuite{
+			Name: fmt.Sprintf("%d:%s", t.Task.No, t.Task.Name),
+			Time: elapsed(t.Task.StartedAt, t.Task.FinishedAt),
+		}
+		if !t.Task.StartedAt.IsZero() {
+			suite.Timestamp = t.Task.StartedAt.Format("2006-01-02T15:04:05")
+		}
+
+		for _, n := range t.Nodes {
+			c := junitTestCase{
+				ClassName: fmt.Sprintf("%s.%s", detail.Event.Name, t.Task.Name),
+				Name:      n.Node,
+				Time:      elapsed(n.StartedAt, n.FinishedAt),
+				SystemOut: n.Log,
+			}
+			switch n.Status {
+			case "error":
+				reason := failureReason(n)
+				c.Failure = &junitMessage{Message: reason, Type: "error", Text: strings.Join(operationLines(n.Operations), "\n")}
+				suite.Failures += 1
+			case "skipped":
+				c.Skipped = &junitMessage{Message: "Task has been skipped by condition"}
+				suite.Skipped += 1
+			case "success":
+			default:
+				c.Error = &junitMessage{Message: fmt.Sprintf("Task has not finished(%s)", n.Status), Type: "timeout"}
+				suite.Errors += 1
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+
+		//	Task that has reached timeout before starting on any node has no testcase
+		if len(t.Nodes) == 0 && t.Task.Status == "timeout" {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				ClassName: fmt.Sprintf("%s.%s", detail.Event.Name, t.Task.Name),
+				Name:      "-",
+				Error:     &junitMessage{Message: "Task has reached timeout before starting on any node", Type: "timeout"},
+			})
+			suite.Errors += 1
+		}
+
+		//	Skippable task that no node has run has no testcase either
+		if len(t.Nodes) == 0 && t.Task.Status == "skip" {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				ClassName: fmt.Sprintf("%s.%s", detail.Event.Name, t.Task.Name),
+				Name:      "-",
+				Skipped:   &junitMessage{Message: "Task has been skipped because no node has run it"},
+			})
+			suite.Skipped += 1
+		}
+
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeJSONReport(w io.Writer, detail *EventDetail) error {
+	report := eventReport{Event: detail.Event}
+	for _, t := range detail.Tasks {
+		tr := taskReport{Task: t.Task}
+		for i := range t.Nodes {
+			tr.Nodes = append(tr.Nodes, nodeTaskResultDetail{Result: &t.Nodes[i], Log: t.Nodes[i].Log})
+		}
+		report.Tasks = append(report.Tasks, tr)
+	}
+
+	d, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(d, '\n'))
+	return err
+}
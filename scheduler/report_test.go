@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	node := func(name string, status string, err string) NodeTaskResult {
+		return NodeTaskResult{Node: name, Status: status, Error: err, Log: "log of " + name, StartedAt: started, FinishedAt: started.Add(2 * time.Second)}
+	}
+
+	cases := []struct {
+		name     string
+		task     TaskResult
+		nodes    []NodeTaskResult
+		cases    int
+		failures int
+		errors   int
+		skipped  int
+		message  string
+	}{
+		{"success", TaskResult{Name: "setup", Status: "success"}, []NodeTaskResult{node("web1", "success", ""), node("web2", "success", "")}, 2, 0, 0, 0, ""},
+		{"error", TaskResult{Name: "deploy", Status: "error"}, []NodeTaskResult{node("web1", "success", ""), node("web2", "error", "Command failed")}, 2, 1, 0, 0, "Command failed"},
+		{"skipped", TaskResult{Name: "cleanup", Status: "skipped"}, []NodeTaskResult{node("web1", "skipped", "")}, 1, 0, 0, 1, "Task has been skipped by condition"},
+		{"unfinished", TaskResult{Name: "wait", Status: "timeout"}, []NodeTaskResult{node("web1", "inprogress", "")}, 1, 0, 1, 0, "Task has not finished(inprogress)"},
+		{"timeout before start", TaskResult{Name: "wait", Status: "timeout"}, nil, 1, 0, 1, 0, "Task has reached timeout before starting on any node"},
+		{"skip without nodes", TaskResult{Name: "optional", Status: "skip"}, nil, 1, 0, 0, 1, "Task has been skipped because no node has run it"},
+		{"no nodes", TaskResult{Name: "noop", Status: "success"}, nil, 0, 0, 0, 0, ""},
+	}
+	for _, c := range cases {
+		detail := &EventDetail{
+			Event: EventResult{ID: "id1", Name: "deploy", StartedAt: started, FinishedAt: started.Add(time.Minute)},
+			Tasks: []TaskDetail{{Task: c.task, Nodes: c.nodes}},
+		}
+		var b bytes.Buffer
+		if err := writeJUnitReport(&b, detail); err != nil {
+			t.Errorf("%s: writeJUnitReport returns error: %s", c.name, err)
+			continue
+		}
+		var report junitTestSuites
+		if err := xml.Unmarshal(b.Bytes(), &report); err != nil {
+			t.Errorf("%s: report isn't valid XML(%s)", c.name, err)
+			continue
+		}
+
+		if report.Name != "deploy(id1)" || report.Time != 60 || len(report.Suites) != 1 {
+			t.Errorf("%s: testsuites is %+v", c.name, report)
+			continue
+		}
+		suite := report.Suites[0]
+		if suite.Tests != c.cases || len(suite.Cases) != c.cases || suite.Failures != c.failures || suite.Errors != c.errors || suite.Skipped != c.skipped {
+			t.Errorf("%s: testsuite has tests=%d failures=%d errors=%d skipped=%d, want %d %d %d %d", c.name, suite.Tests, suite.Failures, suite.Errors, suite.Skipped, c.cases, c.failures, c.errors, c.skipped)
+		}
+		if report.Tests != suite.Tests || report.Failures != suite.Failures || report.Errors != suite.Errors || report.Skipped != suite.Skipped {
+			t.Errorf("%s: totals of testsuites don't match testsuite", c.name)
+		}
+
+		var message string
+		for _, tc := range suite.Cases {
+			if tc.ClassName != "deploy."+c.task.Name {
+				t.Errorf("%s: classname is %s", c.name, tc.ClassName)
+			}
+			for _, m := range []*junitMessage{tc.Failure, tc.Error, tc.Skipped} {
+				if m != nil {
+					message = m.Message
+				}
+			}
+		}
+		if message != c.message {
+			t.Errorf("%s: message is %q, want %q", c.name, message, c.message)
+		}
+	}
+}
+
+func TestWriteJUnitReportTotals(t *testing.T) {
+	started := time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC)
+	detail := &EventDetail{
+		Event: EventResult{ID: "id1", Name: "deploy", StartedAt: started, FinishedAt: started},
+		Tasks: []TaskDetail{
+			{Task: TaskResult{No: 0, Name: "setup", Status: "success"}, Nodes: []NodeTaskResult{{Node: "web1", Status: "skipped"}, {Node: "web2", Status: "error"}}},
+			{Task: TaskResult{No: 1, Name: "deploy", Status: "timeout"}, Nodes: []NodeTaskResult{{Node: "web1", Status: "skipped"}, {Node: "web2", Status: "inprogress"}}},
+			{Task: TaskResult{No: 2, Name: "cleanup", Status: "skip"}},
+		},
+	}
+	var b bytes.Buffer
+	if err := writeJUnitReport(&b, detail); err != nil {
+		t.Fatalf("writeJUnitReport returns error: %s", err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &report); err != nil {
+		t.Fatalf("report isn't valid XML(%s)", err)
+	}
+	if report.Tests != 5 || report.Failures != 1 || report.Errors != 1 || report.Skipped != 3 || len(report.Suites) != 3 {
+		t.Errorf("testsuites has tests=%d failures=%d errors=%d skipped=%d suites=%d, want 5 1 1 3 3", report.Tests, report.Failures, report.Errors, report.Skipped, len(report.Suites))
+	}
+}
+
+func TestReportFormat(t *testing.T) {
+	cases := map[string]string{
+		"report.json": "json",
+		"report.xml":  "junit",
+		"report":      "junit",
+	}
+	for path, expected := range cases {
+		if actual := ReportFormat(path); actual != expected {
+			t.Errorf("ReportFormat(%s) = %s, want %s", path, actual, expected)
+		}
+	}
+}
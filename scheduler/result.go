@@ -3,95 +3,108 @@ package scheduler
 import (
 	"encoding/json"
 	"fmt"
+	"metronome/task"
 	"metronome/util"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
 )
 
 const EVENT_RESULT_KEY = "metronome/results"
 
+//	Version of result schema on consul KVS
+//	Results that don't have version(0) have been written by agent before versioning
+const RESULT_VERSION = 1
+
+//	Version of agent that is recorded to each result
+var AgentVersion string
+
 type Result interface {
 	Key() string
 }
 
+//	Result on consul KVS that can't be decoded, such as one written by incompatible agent
+type InvalidResultError struct {
+	Key    string
+	Reason error
+}
+
+func (e *InvalidResultError) Error() string {
+	return fmt.Sprintf("Result %s is invalid(%s)", e.Key, e.Reason)
+}
+
 //	Result of entire event
 type EventResult struct {
-	ID         string
-	Name       string
-	Status     string
-	StartedAt  time.Time
-	FinishedAt time.Time
+	Version      int     `json:",omitempty"`
+	ID           string
+	Name         string
+	Status       string
+	Error        string `json:",omitempty"`
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Duration     float64 `json:",omitempty"`
+	AgentVersion string  `json:",omitempty"`
 }
 
 //	Result of task
 type TaskResult struct {
-	EventID    string
-	No         int
-	Name       string
-	Status     string
-	StartedAt  time.Time
-	FinishedAt time.Time
+	Version      int `json:",omitempty"`
+	EventID      string
+	No           int
+	Name         string
+	Pattern      string            `json:",omitempty"`
+	Arguments    map[string]string `json:",omitempty"`
+	Status       string
+	Error        string `json:",omitempty"`
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Duration     float64 `json:",omitempty"`
+	AgentVersion string  `json:",omitempty"`
 }
 
 //	Result of task on individual node
 type NodeTaskResult struct {
-	EventID    string
-	No         int
-	Node       string
-	Status     string
-	Log        string `json:"-"`
-	StartedAt  time.Time
-	FinishedAt time.Time
+	Version      int `json:",omitempty"`
+	EventID      string
+	No           int
+	Node         string
+	Pattern      string `json:",omitempty"`
+	Task         string `json:",omitempty"`
+	Status       string
+	ExitCode     int    `json:",omitempty"`
+	Error        string `json:",omitempty"`
+	Log          string `json:"-"`
+	Operations   []task.OperationResult `json:",omitempty"`
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Duration     float64 `json:",omitempty"`
+	AgentVersion string  `json:",omitempty"`
 }
 
-func (r *EventResult) MarshalJSON() ([]byte, error) {
-	//	Marshal result that is excepted empty attributes to JSON format
-	var fields []string
-	fields = append(fields, fmt.Sprintf("\"ID\": \"%s\"", r.ID))
-	fields = append(fields, fmt.Sprintf("\"Name\": \"%s\"", r.Name))
-	fields = append(fields, fmt.Sprintf("\"Status\": \"%s\"", r.Status))
-	if !r.StartedAt.IsZero() {
-		fields = append(fields, fmt.Sprintf("\"StartedAt\": \"%s\"", r.StartedAt.Format(time.RFC3339)))
-	}
-	if !r.FinishedAt.IsZero() {
-		fields = append(fields, fmt.Sprintf("\"FinishedAt\": \"%s\"", r.FinishedAt.Format(time.RFC3339)))
-	}
-	return []byte(fmt.Sprintf("{ %s }", strings.Join(fields, ","))), nil
+type EventResults []EventResult
+
+func (r EventResults) Len() int {
+	return len(r)
 }
 
-func (r *TaskResult) MarshalJSON() ([]byte, error) {
-	//	Marshal result that is excepted empty attributes to JSON format
-	var fields []string
-	fields = append(fields, fmt.Sprintf("\"EventID\": \"%s\"", r.EventID))
-	fields = append(fields, fmt.Sprintf("\"No\": %d", r.No))
-	fields = append(fields, fmt.Sprintf("\"Name\": \"%s\"", r.Name))
-	fields = append(fields, fmt.Sprintf("\"Status\": \"%s\"", r.Status))
-	if !r.StartedAt.IsZero() {
-		fields = append(fields, fmt.Sprintf("\"StartedAt\": \"%s\"", r.StartedAt.Format(time.RFC3339)))
-	}
-	if !r.FinishedAt.IsZero() {
-		fields = append(fields, fmt.Sprintf("\"FinishedAt\": \"%s\"", r.FinishedAt.Format(time.RFC3339)))
-	}
-	return []byte(fmt.Sprintf("{ %s }", strings.Join(fields, ","))), nil
+func (r EventResults) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
 }
 
-func (r *NodeTaskResult) MarshalJSON() ([]byte, error) {
-	//	Marshal result that is excepted empty attributes to JSON format
-	var fields []string
-	fields = append(fields, fmt.Sprintf("\"EventID\": \"%s\"", r.EventID))
-	fields = append(fields, fmt.Sprintf("\"No\": %d", r.No))
-	fields = append(fields, fmt.Sprintf("\"Node\": \"%s\"", r.Node))
-	fields = append(fields, fmt.Sprintf("\"Status\": \"%s\"", r.Status))
-	if !r.StartedAt.IsZero() {
-		fields = append(fields, fmt.Sprintf("\"StartedAt\": \"%s\"", r.StartedAt.Format(time.RFC3339)))
-	}
-	if !r.FinishedAt.IsZero() {
-		fields = append(fields, fmt.Sprintf("\"FinishedAt\": \"%s\"", r.FinishedAt.Format(time.RFC3339)))
+func (r EventResults) Less(i, j int) bool {
+	return r[i].StartedAt.Before(r[j].StartedAt)
+}
+
+//	Return seconds between started and finished time, or zero when it hasn't finished
+func elapsed(started time.Time, finished time.Time) float64 {
+	if started.IsZero() || finished.IsZero() {
+		return 0
 	}
-	return []byte(fmt.Sprintf("{ %s }", strings.Join(fields, ","))), nil
+	return finished.Sub(started).Seconds()
 }
 
 func (r *EventResult) Key() string {
@@ -106,59 +119,80 @@ func (r *NodeTaskResult) Key() string {
 	return EVENT_RESULT_KEY + "/" + r.EventID + "/" + strconv.Itoa(r.No) + "/" + r.Node
 }
 
+//	Save results with current schema version and agent version
 func (r *EventResult) Save() error {
+	r.Version = RESULT_VERSION
+	r.AgentVersion = AgentVersion
+	r.Duration = elapsed(r.StartedAt, r.FinishedAt)
 	return putResult(r)
 }
 
 func (r *TaskResult) Save() error {
+	r.Version = RESULT_VERSION
+	r.AgentVersion = AgentVersion
+	r.Duration = elapsed(r.StartedAt, r.FinishedAt)
 	return putResult(r)
 }
 
 func (r *NodeTaskResult) Save() error {
+	r.Version = RESULT_VERSION
+	r.AgentVersion = AgentVersion
+	r.Duration = elapsed(r.StartedAt, r.FinishedAt)
+
 	//	Save any result to consul KVS
 	if err := putResult(r); err != nil {
 		return err
 	}
-	kv := &api.KVPair{
-		Key:   r.Key() + "/log",
-		Value: []byte(r.Log),
-	}
-	_, err := util.Consul().KV().Put(kv, &api.WriteOptions{})
-	return err
+	return saveLog(r.Key()+"/log", r.Log)
 }
 
 func (r *EventResult) IsFinished() bool {
-	return r.Status == "success" || r.Status == "error"
+	return r.Status == "success" || r.Status == "error" || r.Status == "skipped"
+}
+
+func (r *EventResult) IsFailed() bool {
+	return r.Status == "error" || r.Status == "timeout"
 }
 
 func (r *TaskResult) IsFinished() bool {
-	return r.Status == "success" || r.Status == "error"
+	return r.Status == "success" || r.Status == "error" || r.Status == "skipped"
 }
 
 func (r *NodeTaskResult) IsFinished() bool {
-	return r.Status == "success" || r.Status == "error"
+	return r.Status == "success" || r.Status == "error" || r.Status == "skipped"
 }
 
 func (r *TaskResult) GetNodeResults() ([]NodeTaskResult, error) {
+	return r.getNodeResults(true)
+}
+
+//	Return results on all nodes without reading their logs
+func (r *TaskResult) GetNodeSummaries() ([]NodeTaskResult, error) {
+	return r.getNodeResults(false)
+}
+
+func (r *TaskResult) getNodeResults(withLog bool) ([]NodeTaskResult, error) {
 	//	Collect all results on node that belongs with this task
 	var results []NodeTaskResult
 
-	prefix := EVENT_RESULT_KEY + "/" + r.EventID + "/" + strconv.Itoa(r.No)
-	kvs, _, err := util.Consul().KV().List(prefix, &api.QueryOptions{})
+	nodes, err := childKeys(r.Key())
 	if err != nil {
 		return nil, err
 	}
 
-	for _, kv := range kvs {
-		//	Except log record on each node
-		node := strings.TrimPrefix(kv.Key, prefix)
-		if node == "" || strings.HasSuffix(node, "/log") {
-			continue
-		}
-		result, err := getNodeTaskResult(r.EventID, r.No, node)
+	for _, node := range nodes {
+		result, err := getNodeTaskSummary(r.EventID, r.No, node)
 		if err != nil {
 			return nil, err
 		}
+		if result == nil {
+			continue
+		}
+		if withLog {
+			if result.Log, err = loadLog(r.Key() + "/" + node + "/log"); err != nil {
+				return nil, err
+			}
+		}
 		results = append(results, *result)
 	}
 	return results, nil
@@ -171,6 +205,9 @@ func getEventResult(id string) (*EventResult, error) {
 	if !found || err != nil {
 		return nil, err
 	}
+	if result.Version == 0 {
+		result.Duration = elapsed(result.StartedAt, result.FinishedAt)
+	}
 	return &result, err
 }
 
@@ -181,26 +218,125 @@ func getTaskResult(id string, no int) (*TaskResult, error) {
 	if !found || err != nil {
 		return nil, err
 	}
+	if result.Version == 0 {
+		result.Duration = elapsed(result.StartedAt, result.FinishedAt)
+	}
 	return &result, err
 }
 
+//	Collect results of all events ordered by started time
+func getEventResults() ([]EventResult, error) {
+	var results []EventResult
+
+	ids, err := childKeys(EVENT_RESULT_KEY)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		result, err := getEventResult(id)
+		if _, ok := err.(*InvalidResultError); ok {
+			//	Skip it to keep one broken record from blocking history and gc of all events
+			log.Warnf("Skip event result(%s)", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	sort.Sort(EventResults(results))
+	return results, nil
+}
+
+//	Delete results of event including all tasks and nodes
+func deleteEventResult(id string) error {
+	if _, err := util.Consul().KV().DeleteTree(EVENT_RESULT_KEY+"/"+id+"/", &api.WriteOptions{}); err != nil {
+		return err
+	}
+	_, err := util.Consul().KV().Delete(EVENT_RESULT_KEY+"/"+id, &api.WriteOptions{})
+	return err
+}
+
+//	Collect results of all tasks that belongs with specified event ordered by number
+func getTaskResults(id string) ([]TaskResult, error) {
+	var results []TaskResult
+
+	keys, err := childKeys(EVENT_RESULT_KEY + "/" + id)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, k := range keys {
+		if no, err := strconv.Atoi(k); err == nil {
+			numbers = append(numbers, no)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, no := range numbers {
+		result, err := getTaskResult(id, no)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
 func getNodeTaskResult(id string, no int, node string) (*NodeTaskResult, error) {
+	result, err := getNodeTaskSummary(id, no, node)
+	if result == nil || err != nil {
+		return nil, err
+	}
+
+	//	Read log from /metronome/result/[EventID]/[No]/[Node]/log
+	result.Log, err = loadLog(EVENT_RESULT_KEY + "/" + id + "/" + strconv.Itoa(no) + "/" + node + "/log")
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//	Return result on node without reading log that may be large
+func getNodeTaskSummary(id string, no int, node string) (*NodeTaskResult, error) {
 	var result NodeTaskResult
 	key := EVENT_RESULT_KEY + "/" + id + "/" + strconv.Itoa(no) + "/" + node
 	found, err := getResult(key, &result)
 	if !found || err != nil {
 		return nil, err
 	}
+	if result.Version == 0 {
+		result.Duration = elapsed(result.StartedAt, result.FinishedAt)
+	}
+	return &result, nil
+}
 
-	//	Read log from /metronome/result/[EventID]/[No]/[Node]/log
-	kv, _, err := util.Consul().KV().Get(key+"/log", &api.QueryOptions{})
+//	Return names of direct children under specified key on consul KVS
+func childKeys(parent string) ([]string, error) {
+	prefix := parent + "/"
+	keys, _, err := util.Consul().KV().Keys(prefix, "/", &api.QueryOptions{})
 	if err != nil {
 		return nil, err
 	}
-	if kv != nil {
-		result.Log = string(kv.Value)
+
+	var results []string
+	found := make(map[string]bool)
+	for _, k := range keys {
+		name := strings.TrimSuffix(strings.TrimPrefix(k, prefix), "/")
+		if name == "" || found[name] {
+			continue
+		}
+		found[name] = true
+		results = append(results, name)
 	}
-	return &result, err
+	sort.Strings(results)
+	return results, nil
 }
 
 //	Get any result from consul KVS
@@ -215,7 +351,7 @@ func getResult(key string, result interface{}) (bool, error) {
 	}
 
 	if err := json.Unmarshal(kv.Value, &result); err != nil {
-		return false, err
+		return false, &InvalidResultError{Key: key, Reason: err}
 	}
 	return true, nil
 }
@@ -2,10 +2,10 @@ package scheduler
 
 import (
 	"bufio"
-	"bytes"
-	"io"
+	"fmt"
 	"metronome/config"
 	"metronome/queue"
+	"metronome/task"
 	"metronome/util"
 	"os"
 	"time"
@@ -22,6 +22,14 @@ func (s *Scheduler) Run() {
 		panic(err)
 	}
 
+	s.watchTriggers()
+	go s.collectGarbagePeriodically()
+	go deleteExpiredTaskLogFilesPeriodically()
+	if config.WatchInterval > 0 {
+		//	Files are watched until agent exits
+		go s.watchFiles(time.Duration(config.WatchInterval)*time.Second, nil)
+	}
+
 	ch := make(chan EventTask)
 	go taskTimeout(ch)
 	for {
@@ -43,13 +51,10 @@ func (s *Scheduler) Run() {
 
 func (s *Scheduler) polling(ch chan EventTask) error {
 	//	Create critical section by consul lock
-	l, err := util.Consul().LockKey(LOCK_KEY)
+	l, err := lockCriticalSection()
 	if err != nil {
 		return err
 	}
-	if _, err := l.Lock(nil); err != nil {
-		return err
-	}
 	defer l.Unlock()
 
 	//	Polling tasks from queue
@@ -73,7 +78,15 @@ func (s *Scheduler) polling(ch chan EventTask) error {
 		}
 	}
 
+	//	Wait for resuming without dispatching event and starting task when paused
+	paused, err := IsPaused()
+	if err != nil {
+		return err
+	}
+
 	switch {
+	case paused && (len(eventTasks) == 0 || eventTasks[0].Runnable(s.node)):
+		log.Debug("Scheduler has been paused")
 	case len(eventTasks) == 0:
 		return s.dispatchEvent()
 	case eventTasks[0].Runnable(s.node):
@@ -83,7 +96,7 @@ func (s *Scheduler) polling(ch chan EventTask) error {
 	case eventTasks[0].IsFinished(ch):
 		return s.finishTask(eventTasks[0])
 	default:
-		log.Debugf("Wait a task will have been finished by other instance(%s)", eventTasks[0].String())
+		log.WithFields(eventTasks[0].logFields(s.node)).Debugf("Wait a task will have been finished by other instance(%s)", eventTasks[0].String())
 	}
 	return nil
 }
@@ -91,7 +104,6 @@ func (s *Scheduler) polling(ch chan EventTask) error {
 //	Trigger channel when current task has been reached timeout
 func taskTimeout(ch chan EventTask) {
 	var prev EventTask
-	var now EventTask
 	for {
 		time.Sleep(1 * time.Second)
 		pq := &queue.Queue{
@@ -100,7 +112,12 @@ func taskTimeout(ch chan EventTask) {
 		}
 
 		//	Wait until task has dispatched
-		if err := pq.FetchHead(&now); err != nil || now.ID == "" || prev.ID == now.ID && prev.No == now.No {
+		var now EventTask
+		if err := pq.FetchHead(&now); err != nil {
+			continue
+		}
+		observeProgressHead(now)
+		if now.ID == "" || prev.ID == now.ID && prev.No == now.No {
 			continue
 		}
 		prev = now
@@ -151,6 +168,7 @@ func changeTask(et EventTask, cancel chan bool) chan bool {
 				return
 			}
 
+			observeProgressHead(now)
 			if et.ID != now.ID || et.No != now.No {
 				ch <- true
 				return
@@ -205,17 +223,24 @@ func (s *Scheduler) dispatchEvent() error {
 	if err, found := eq.DeQueue(&consulEvent); err != nil || !found {
 		return err
 	}
-	result, err := getEventResult(consulEvent.ID)
+	handled, err := isHandled(consulEvent.ID)
 	if err != nil {
 		return err
 	}
-	if result != nil {
+	if handled {
 		log.Debugf("Ignore event(ID: %s, Name: %s) already has been executed", consulEvent.ID, consulEvent.Name)
 		return nil
 	}
+	logger := log.WithFields(log.Fields{
+		"event_id":   consulEvent.ID,
+		"event_name": consulEvent.Name,
+		"node":       s.node,
+	})
 
 	//	Collect events over all task.yml and dispatch tasks to progress task queue
-	log.Infof("Dispatch event(ID: %s, Name: %s)", consulEvent.ID, consulEvent.Name)
+	logger.Infof("Dispatch event(ID: %s, Name: %s)", consulEvent.ID, consulEvent.Name)
+	eventsDispatched.Inc(consulEvent.Name)
+	params := parsePayload(consulEvent.Payload).Params
 	events := s.sortedEvents(consulEvent.Name)
 	c := 0
 	for _, v := range events {
@@ -225,7 +250,10 @@ func (s *Scheduler) dispatchEvent() error {
 				Pattern:   v.Pattern,
 				ID:        consulEvent.ID,
 				No:        c,
+				Event:     consulEvent.Name,
 				Task:      v.Task,
+				Params:    params,
+				Filter:    s.taskFilter(v.Pattern, v.Task),
 				Skippable: config.Skippable,
 			})
 			c += 1
@@ -234,47 +262,99 @@ func (s *Scheduler) dispatchEvent() error {
 				t.Pattern = v.Pattern
 				t.ID = consulEvent.ID
 				t.No = c
+				t.Event = consulEvent.Name
+				t.Params = params
+				t.Filter = s.taskFilter(v.Pattern, t.Task)
 				pq.EnQueue(t)
 				c += 1
 			}
 		}
 	}
 
+	audit(AuditRecord{
+		Action:    "dispatch",
+		Result:    "success",
+		EventID:   consulEvent.ID,
+		EventName: consulEvent.Name,
+		Params:    params,
+		Message:   fmt.Sprintf("%d task(s) have been dispatched", c),
+	})
+
 	//	Log starting event as EventResult on KVS
-	result = &EventResult{
+	result := &EventResult{
 		ID:        consulEvent.ID,
 		Name:      consulEvent.Name,
 		Status:    "inprogress",
 		StartedAt: time.Now(),
 	}
-	return result.Save()
-}
+	if c > 0 {
+		return result.Save()
+	}
 
-func (s *Scheduler) runTask(task EventTask) error {
-	var b bytes.Buffer
-	writer := io.MultiWriter(&b, os.Stdout)
-	log.SetOutput(writer)
+	//	Event without tasks has finished at once, otherwise it stays inprogress and fire --wait never returns
+	logger.Infof("Finish event(ID: %s, Name: %s) that has no tasks", consulEvent.ID, consulEvent.Name)
+	result.Status = "success"
+	result.FinishedAt = result.StartedAt
+	if err := result.Save(); err != nil {
+		return err
+	}
+	eventsFinished.Inc(result.Name, result.Status)
+	s.notifyEvent(result)
+	return nil
+}
 
-	log.Infof("Run task(%s)", task.String())
+func (s *Scheduler) runTask(et EventTask) error {
+	//	Capture log of this task as text without fields that are obvious in task log
+	var b util.LogBuffer
+	l := util.NewLogger()
+	l.Hooks.Add(&util.WriterHook{
+		Writer:    &b,
+		Formatter: &util.LogFormatter{ExcludeFields: []string{"event_id", "event_name", "no", "pattern", "task", "node"}},
+	})
+	logger := l.WithFields(et.logFields(s.node))
+
+	logger.Infof("Run task(%s)", et.String())
+
+	//	Record resolved arguments of task in result, error of them is reported when task runs
+	var args map[string]string
+	if schedule, t, found := s.findTask(et.Pattern, et.Task); found {
+		args, _ = et.arguments(s, schedule, t)
+	}
 
 	//	Run single task with result log
-	if err := task.WriteStartLog(s.node); err != nil {
+	if err := et.WriteStartLog(s.node, args); err != nil {
 		return err
 	}
+	streamer := startLogStreamer(&NodeTaskResult{EventID: et.ID, No: et.No, Node: s.node}, &b)
 
 	status := "success"
-	if err := task.Run(s); err != nil {
-		status = "error"
-		log.Error("Following error has occurred while executing task")
-		log.Error(err)
+	started := time.Now()
+	operations, taskErr := et.Run(s, logger)
+	if taskErr != nil {
+		if taskErr == task.ErrSkipped {
+			status = "skipped"
+		} else {
+			status = "error"
+			logger.Error("Following error has occurred while executing task")
+			logger.Error(taskErr)
+		}
 	}
 
-	return task.WriteFinishLog(s.node, status, b.String())
+	taskDuration.Observe(time.Since(started).Seconds(), et.Pattern, et.Task, status)
+
+	streamer.Stop()
+	if err := writeTaskLogFile(et, b.String()); err != nil {
+		log.Warnf("Failed to write task log file(%s)", err)
+	}
+	if err := et.WriteFinishLog(s.node, status, b.String(), operations, taskErr); err != nil {
+		return err
+	}
+	return streamer.Clear()
 }
 
 //	Finish current task when no node in consul catalog will execute current task
 func (s *Scheduler) finishTask(task EventTask) error {
-	log.Infof("Finish task(%s)", task.String())
+	log.WithFields(task.logFields(s.node)).Infof("Finish task(%s)", task.String())
 	pq := &queue.Queue{
 		Client: util.Consul(),
 		Key:    PROGRESS_QUEUE_KEY,
@@ -291,7 +371,8 @@ func (s *Scheduler) finishTask(task EventTask) error {
 	}
 
 	//	Collect task results over all nodes
-	status := "success"
+	//	Task is skipped when condition isn't satisfied on all nodes
+	status := "skipped"
 	if len(nodeResults) == 0 {
 		if task.Skippable {
 			status = "skip"
@@ -300,14 +381,23 @@ func (s *Scheduler) finishTask(task EventTask) error {
 		}
 	}
 
+	var message string
 	for _, nr := range nodeResults {
 		if nr.Status == "error" {
 			status = "error"
+			message = fmt.Sprintf("%s: %s", nr.Node, nr.Error)
 			break
 		}
 		if nr.Status == "inprogress" {
 			status = "timeout"
 		}
+		if nr.Status == "success" && status == "skipped" {
+			status = "success"
+		}
+	}
+
+	if status == "timeout" {
+		message = "Task has reached timeout"
 	}
 
 	if status == "error" || status == "timeout" {
@@ -317,10 +407,12 @@ func (s *Scheduler) finishTask(task EventTask) error {
 
 	//	Log finishing task as TaskResult on KVS
 	result.Status = status
+	result.Error = message
 	result.FinishedAt = time.Now()
 	if err := result.Save(); err != nil {
 		return err
 	}
+	s.notifyTask(task, result)
 
 	//	Dequeue task from task queue when finished task over all all nodes
 	var dummy EventTask
@@ -338,11 +430,20 @@ func (s *Scheduler) finishTask(task EventTask) error {
 		if err != nil {
 			return err
 		}
+		//	Event that has skipped last task by condition has finished successfully
 		eventResult.Status = status
+		if status == "skipped" {
+			eventResult.Status = "success"
+		}
+		if message != "" {
+			eventResult.Error = fmt.Sprintf("Task %d(%s) has failed(%s)", task.No, task.Task, message)
+		}
 		eventResult.FinishedAt = time.Now()
 		if err := eventResult.Save(); err != nil {
 			return err
 		}
+		eventsFinished.Inc(eventResult.Name, eventResult.Status)
+		s.notifyEvent(eventResult)
 	}
 
 	return nil
@@ -1,28 +1,40 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"metronome/config"
 	"metronome/task"
 	"metronome/util"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
 )
 
 const INDENT_WIDTH = 2
 
 //	Represent task.yml as golang structure
 type Schedule struct {
-	path         string
-	pattern      string
-	Environments map[string]string
-	Variables    map[string]string
-	Default      map[string]interface{}
-	Events       map[string]*Event
-	Tasks        map[string]*task.Task
+	path          string
+	pattern       string
+	userVariables map[string]string
+	Environments  map[string]string
+	Variables     map[string]string
+	Default       map[string]interface{}
+	Events        map[string]*Event
+	Imports       []string
+	Tasks         map[string]*task.Task
+	Notifications []*Notification
+}
+
+//	Shared task library that is imported by imports in task.yml
+type taskLibrary struct {
+	Tasks map[string]*task.Task
 }
 
 //	Set path of task.yml and pattern directory to all tasks and operations
@@ -34,27 +46,92 @@ func (s *Schedule) PostUnmarshal(path string, pattern string) {
 		e.SetPattern(path, pattern)
 	}
 	for k, t := range s.Tasks {
-		t.Name = k
-		if t.Timeout == 0 {
-			t.Timeout = int32(s.Default["timeout"].(float64))
-		}
+		s.setupTask(k, t, path)
+	}
 
-		t.SetPattern(path, pattern)
-		for _, o := range t.Operations {
-			if m, ok := s.Default[o.String()]; ok {
-				if v, ok := m.(map[string]interface{}); ok {
-					o.SetDefault(v)
-				}
-			}
-		}
+	for _, n := range s.Notifications {
+		n.setDefault()
 	}
 
 	if s.Variables == nil {
 		s.Variables = make(map[string]string)
 	}
 	s.Variables["role"] = config.Role
+}
+
+//	Set defaults of schedule to task that is defined in path
+func (s *Schedule) setupTask(name string, t *task.Task, path string) {
+	t.Name = name
+	if t.Timeout == 0 {
+		t.Timeout = int32(s.Default["timeout"].(float64))
+	}
+	if t.Debounce.Quiet == 0 {
+		t.Debounce.Quiet = TRIGGER_QUIET_PERIOD
+	}
+	if t.Debounce.Max == 0 {
+		t.Debounce.Max = TRIGGER_MAX_DELAY
+	}
+
+	t.SetPattern(path, s.pattern)
+	for _, o := range t.Operations {
+		if m, ok := s.Default[o.String()]; ok {
+			if v, ok := m.(map[string]interface{}); ok {
+				o.SetDefault(v)
+			}
+		}
+	}
+}
+
+//	Return variables in task.yml over user variables that have been loaded with this schedule
+//	User variables are kept in each schedule to replace them together with schedules on reload
+func (s *Schedule) variables() map[string]string {
+	vars := make(map[string]string)
+	for k, v := range s.userVariables {
+		vars[k] = v
+	}
+	for k, v := range s.Variables {
+		vars[k] = v
+	}
+	return vars
+}
 
-	s.setEnvironmentVariables()
+//	Return absolute path of imported file that is relative to directory of task.yml
+func (s *Schedule) importPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(s.path), path)
+}
+
+//	Add tasks in imported libraries to schedule
+//	Imported task belongs to this pattern but runs in directory of library
+func (s *Schedule) Import() error {
+	if len(s.Imports) > 0 && s.Tasks == nil {
+		s.Tasks = make(map[string]*task.Task)
+	}
+	for _, i := range s.Imports {
+		path := s.importPath(i)
+		d, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to import %s(%s)", i, err))
+		}
+		var library taskLibrary
+		if err := yaml.Unmarshal(d, &library); err != nil {
+			if terr := taskError(d); terr != nil {
+				err = terr
+			}
+			return errors.New(fmt.Sprintf("Failed to import %s(%s)", i, err))
+		}
+
+		for k, t := range library.Tasks {
+			if prev, found := s.Tasks[k]; found {
+				return errors.New(fmt.Sprintf("Task %s in %s is also defined in %s", k, i, prev.Path))
+			}
+			s.setupTask(k, t, path)
+			s.Tasks[k] = t
+		}
+	}
+	return nil
 }
 
 func (s *Schedule) String() string {
@@ -99,15 +176,30 @@ func indent(s string, n int) string {
 	return strings.Join(results, "\n")
 }
 
-//	Set environment variables from environment node in task.yml
-func (s *Schedule) setEnvironmentVariables() {
-	r := regexp.MustCompile(`\$[a-zA-Z0-9_-]+`)
-	for k, v := range s.Environments {
-		v = r.ReplaceAllStringFunc(v, func(s string) string {
-			return os.Getenv(s[1:len(s)])
-		})
-		v = util.ParseString(v, s.Variables)
-		os.Setenv(k, v)
+//	Resolve environment node in task.yml and pass it to commands of all tasks in schedule
+//	Environment of agent process isn't changed, so reload never changes it under running tasks
+//	Environment that can't be rendered isn't passed to commands, validator reports it as error
+func (s *Schedule) applyEnvironments() {
+	var env []string
+	for _, k := range sortedKeys(s.Environments) {
+		v, err := s.resolveEnvironment(k)
+		if err != nil {
+			log.Errorf("Failed to resolve environment(%s): %s", k, err)
+			continue
+		}
+		env = append(env, k+"="+v)
 		log.Info(fmt.Sprintf("Set environment(%s): %s", k, v))
 	}
+	for _, t := range s.Tasks {
+		t.SetEnvironments(env)
+	}
+}
+
+//	Expand $VAR by environment of agent and render variables in value of environment
+func (s *Schedule) resolveEnvironment(k string) (string, error) {
+	r := regexp.MustCompile(`\$[a-zA-Z0-9_-]+`)
+	v := r.ReplaceAllStringFunc(s.Environments[k], func(s string) string {
+		return os.Getenv(s[1:len(s)])
+	})
+	return util.Render(v, s.variables())
 }
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"metronome/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLibraryYAML = `
+tasks:
+  register:
+    timeout: 60
+    operations:
+      - echo: register
+  deregister:
+    operations:
+      - echo: deregister
+`
+
+func TestImport(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{
+		"app": `imports:
+  - ../shared/task.yml
+tasks:
+  restart:
+    operations:
+      - echo: restart
+`,
+		"conflict": `imports:
+  - ../shared/task.yml
+tasks:
+  register:
+    operations:
+      - echo: register
+`,
+		"missing": `imports:
+  - ../shared/missing.yml
+`,
+		"shared": testLibraryYAML,
+	})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+	library := filepath.Join(dir, "shared/task.yml")
+
+	cases := []struct {
+		pattern  string
+		expected []string
+		err      string
+	}{
+		{"app", []string{"deregister", "register", "restart"}, ""},
+		{"conflict", nil, "Task register in ../shared/task.yml is also defined in " + filepath.Join(dir, "conflict/task.yml")},
+		{"missing", nil, "shared/missing.yml"},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.pattern, "task.yml")
+		s := newTestScheduler(t, nil)
+		config.Files = []string{path}
+		err := s.load()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: load() returns error %v, want %q", c.pattern, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: load() returns error: %s", c.pattern, err)
+			continue
+		}
+
+		var names []string
+		for _, name := range c.expected {
+			if _, found := s.schedules[c.pattern].Tasks[name]; found {
+				names = append(names, name)
+			}
+		}
+		if len(names) != len(c.expected) || len(s.schedules[c.pattern].Tasks) != len(c.expected) {
+			t.Errorf("%s: load() loads tasks %v, want %v", c.pattern, s.schedules[c.pattern].Tasks, c.expected)
+		}
+
+		//	Imported task belongs to importing pattern but runs in directory of library
+		imported := s.schedules[c.pattern].Tasks["register"]
+		if imported.Pattern != c.pattern || imported.Path != library || imported.Timeout != 60 {
+			t.Errorf("%s: imported task has pattern %s, path %s and timeout %d, want %s, %s and 60", c.pattern, imported.Pattern, imported.Path, imported.Timeout, c.pattern, library)
+		}
+		if d := s.schedules[c.pattern].Tasks["deregister"]; d.Timeout != 1800 {
+			t.Errorf("%s: imported task has timeout %d, want default 1800", c.pattern, d.Timeout)
+		}
+		if r := s.schedules[c.pattern].Tasks["restart"]; r.Path != path {
+			t.Errorf("%s: own task has path %s, want %s", c.pattern, r.Path, path)
+		}
+	}
+}
+
+func TestFindTask(t *testing.T) {
+	s := newTestScheduler(t, map[string]string{
+		"app": testTaskYAML,
+		"db":  testLibraryYAML,
+	})
+
+	cases := []struct {
+		pattern string
+		name    string
+		found   bool
+		owner   string
+	}{
+		{"app", "restart", true, "app"},
+		{"app", "register", false, ""},
+		{"app", "db:register", true, "db"},
+		{"app", "db:restart", false, ""},
+		{"app", "unknown:restart", false, ""},
+		{"unknown", "restart", false, ""},
+	}
+	for _, c := range cases {
+		schedule, task, found := s.findTask(c.pattern, c.name)
+		if found != c.found {
+			t.Errorf("findTask(%s, %s) returns found %v, want %v", c.pattern, c.name, found, c.found)
+			continue
+		}
+		if !found {
+			continue
+		}
+		if schedule.pattern != c.owner || task.Pattern != c.owner {
+			t.Errorf("findTask(%s, %s) returns task in %s of schedule %s, want %s", c.pattern, c.name, task.Pattern, schedule.pattern, c.owner)
+		}
+	}
+}
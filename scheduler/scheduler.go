@@ -1,13 +1,15 @@
 package scheduler
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"metronome/config"
-	"metronome/util"
+	"metronome/task"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ghodss/yaml"
@@ -18,8 +20,12 @@ const PROGRESS_QUEUE_KEY = "metronome/progress_task_queue"
 const LOCK_KEY = "metronome/event_queue/lock"
 
 type Scheduler struct {
+	mu        sync.RWMutex
 	schedules map[string]Schedule
 	node      string
+
+	//	Closed to stop watching triggers of current schedules when schedules have been reloaded
+	stopTriggers chan struct{}
 }
 
 func NewScheduler() (*Scheduler, error) {
@@ -29,45 +35,66 @@ func NewScheduler() (*Scheduler, error) {
 	if err := scheduler.load(); err != nil {
 		return nil, err
 	}
+	recordReload(nil)
 
 	log.Info("Scheduler initialized")
 	return scheduler, nil
 }
 
-//	Load shedule information from all task.yml
+//	Load shedule information from all task.yml with same loader and checks as validate subcommand
+//	Agent starts with problems that don't prevent loading task.yml unless -strict-validation is set
 func (scheduler *Scheduler) load() error {
-	for _, path := range config.Files {
-		if path == "" {
-			continue
-		}
-		if !util.Exists(path) {
-			log.Warnf("Schedule file does not found(%s)", path)
-			continue
-		}
-		log.Info(fmt.Sprintf("Load %s", path))
+	schedules, err := loadSchedules(config.UserVariables, config.StrictValidation)
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		log.Debug(&schedule)
+	}
+	scheduler.schedules = schedules
+	return nil
+}
 
-		d, err := ioutil.ReadFile(path)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Failed to load config file(%s)\n\t%s", path, err))
-		}
-		var schedule Schedule
-		schedule.Default = taskDefault()
-		if err := yaml.Unmarshal([]byte(d), &schedule); err != nil {
-			return errors.New(fmt.Sprintf("Failed to unmarshal json(%s)\n\t%s", path, err))
-		}
+//	Unmarshal each task separately to tell which task has wrong definition
+//	because error of unmarshaling map doesn't contain its key
+func taskError(d []byte) error {
+	var raw struct {
+		Tasks map[string]json.RawMessage
+	}
+	if err := yaml.Unmarshal(d, &raw); err != nil {
+		return nil
+	}
 
-		patternName := patternName(path)
-		schedule.PostUnmarshal(path, patternName)
-		scheduler.schedules[patternName] = schedule
-		log.Debug(&schedule)
+	var names []string
+	for k := range raw.Tasks {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var t task.Task
+		if err := json.Unmarshal(raw.Tasks[name], &t); err != nil {
+			return errors.New(fmt.Sprintf("task %s: %s", name, err))
+		}
 	}
 	return nil
 }
 
+//	Return schedules that are loaded currently
+//	Map is never modified after loading, so caller can read it without lock while reload replaces it
+func (scheduler *Scheduler) current() map[string]Schedule {
+	scheduler.mu.RLock()
+	defer scheduler.mu.RUnlock()
+	return scheduler.schedules
+}
+
 //	Sort event by priority over all patterns
 func (scheduler *Scheduler) sortedEvents(name string) Events {
+	if isTriggerEvent(name) {
+		return scheduler.triggerEvents(name)
+	}
+
 	var events Events
-	for _, v := range scheduler.schedules {
+	for _, v := range scheduler.current() {
 		e, found := v.Events[name]
 		if !found {
 			continue
@@ -78,6 +105,28 @@ func (scheduler *Scheduler) sortedEvents(name string) Events {
 	return events
 }
 
+//	Find task by name in pattern, or in other pattern when name is "pattern:task" format
+//	Return schedule that task belongs to with task
+func (scheduler *Scheduler) findTask(pattern string, name string) (Schedule, *task.Task, bool) {
+	if items := strings.SplitN(name, ":", 2); len(items) == 2 {
+		pattern, name = items[0], items[1]
+	}
+	s, found := scheduler.current()[pattern]
+	if !found {
+		return Schedule{}, nil, false
+	}
+	t, found := s.Tasks[name]
+	return s, t, found
+}
+
+//	Return filter on task definition that is combined with filter on event task
+func (scheduler *Scheduler) taskFilter(pattern string, name string) task.Filter {
+	if _, t, found := scheduler.findTask(pattern, name); found {
+		return t.Filter
+	}
+	return task.Filter{}
+}
+
 func taskDefault() map[string]interface{} {
 	return map[string]interface{}{
 		"timeout": float64(1800),
@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metronome/config"
+	"metronome/task"
+	"metronome/util"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+)
+
+const TRIGGER_EVENT_PREFIX = "trigger:"
+const TRIGGER_QUIET_PERIOD = 5
+const TRIGGER_MAX_DELAY = 60
+const TRIGGER_WAIT_TIME = 5 * time.Minute
+const TRIGGER_RETRY_INTERVAL = 10 * time.Second
+
+//	Watch target of trigger that is specified by task
+//	kv:<key> watches value of key on consul KVS
+//	service:<name>[:tag] watches instances of service on consul catalog
+type Trigger struct {
+	Type    string
+	Key     string
+	Service string
+	Tag     string
+}
+
+//	Snapshot of watched data
+//	Fingerprint is same over all nodes when data is same, but Index isn't because it follows changes of other data
+//	Previous is fingerprint of data before change
+type triggerState struct {
+	Index       uint64
+	Fingerprint string
+	Previous    string
+	Params      map[string]string
+}
+
+func parseTrigger(s string) (*Trigger, error) {
+	items := strings.SplitN(s, ":", 2)
+	if len(items) != 2 || items[1] == "" {
+		return nil, errors.New(fmt.Sprintf("Trigger %s is invalid format", s))
+	}
+
+	switch items[0] {
+	case "kv":
+		return &Trigger{Type: "kv", Key: items[1]}, nil
+	case "service":
+		values := strings.SplitN(items[1], ":", 2)
+		t := &Trigger{Type: "service", Service: values[0]}
+		if len(values) == 2 {
+			t.Tag = values[1]
+		}
+		return t, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Trigger type %s is not supported", items[0]))
+}
+
+//	Wait until watched data has been changed from specified index
+func (t *Trigger) wait(index uint64) (*triggerState, error) {
+	opts := &api.QueryOptions{WaitIndex: index, WaitTime: TRIGGER_WAIT_TIME}
+	switch t.Type {
+	case "kv":
+		kv, meta, err := util.Consul().KV().Get(t.Key, opts)
+		if err != nil {
+			return nil, err
+		}
+		state := &triggerState{
+			Index:  meta.LastIndex,
+			Params: map[string]string{"trigger.key": t.Key, "trigger.value": ""},
+		}
+		if kv != nil {
+			state.Fingerprint = fmt.Sprintf("%d", kv.ModifyIndex)
+			state.Params["trigger.value"] = string(kv.Value)
+		}
+		return state, nil
+	default:
+		services, meta, err := util.Consul().Catalog().Service(t.Service, t.Tag, opts)
+		if err != nil {
+			return nil, err
+		}
+		var entries []string
+		var nodes []string
+		for _, s := range services {
+			entries = append(entries, fmt.Sprintf("%s/%s/%d/%d", s.Node, s.ServiceAddress, s.ServicePort, s.ModifyIndex))
+			nodes = append(nodes, s.Node)
+		}
+		sort.Strings(entries)
+		sort.Strings(nodes)
+		return &triggerState{
+			Index:       meta.LastIndex,
+			Fingerprint: strings.Join(entries, ","),
+			Params:      map[string]string{"trigger.service": t.Service, "trigger.nodes": strings.Join(nodes, ",")},
+		}, nil
+	}
+}
+
+func (t *Trigger) String() string {
+	if t.Type == "kv" {
+		return "kv:" + t.Key
+	}
+	if t.Tag == "" {
+		return "service:" + t.Service
+	}
+	return "service:" + t.Service + ":" + t.Tag
+}
+
+//	Start watching all triggers in task.yml
+//	Watchers of previous schedules are stopped when schedules have been reloaded
+func (scheduler *Scheduler) watchTriggers() {
+	scheduler.mu.Lock()
+	if scheduler.stopTriggers != nil {
+		close(scheduler.stopTriggers)
+	}
+	stop := make(chan struct{})
+	scheduler.stopTriggers = stop
+	schedules := scheduler.schedules
+	scheduler.mu.Unlock()
+
+	for _, s := range schedules {
+		for _, t := range s.Tasks {
+			if t.Trigger == "" {
+				continue
+			}
+			trigger, err := parseTrigger(t.Trigger)
+			if err != nil {
+				log.Errorf("Failed to watch trigger of task %s in %s(%s)", t.Name, t.Pattern, err)
+				continue
+			}
+
+			log.Infof("Watch %s to trigger task %s in %s", trigger.String(), t.Name, t.Pattern)
+			changes := make(chan triggerState)
+			go trigger.watch(changes, stop)
+			go debounce(t, changes, stop)
+		}
+	}
+}
+
+//	Send state to channel each time watched data has been changed
+func (t *Trigger) watch(changes chan<- triggerState, stop <-chan struct{}) {
+	var prev *triggerState
+	var index uint64
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		state, err := t.wait(index)
+		if err != nil {
+			log.Warnf("Failed to watch %s(%s)", t.String(), err)
+			time.Sleep(TRIGGER_RETRY_INTERVAL)
+			continue
+		}
+		index = state.Index
+
+		//	Ignore first state and index changes that doesn't change watched data
+		if prev != nil && prev.Fingerprint != state.Fingerprint {
+			state.Previous = prev.Fingerprint
+			select {
+			case changes <- *state:
+			case <-stop:
+				return
+			}
+		}
+		prev = state
+	}
+}
+
+//	Push a single event after changes have been settled during quiet period or max delay has been reached
+func debounce(t *task.Task, changes <-chan triggerState, stop <-chan struct{}) {
+	quiet := time.Duration(t.Debounce.Quiet) * time.Second
+	max := time.Duration(t.Debounce.Max) * time.Second
+	for {
+		var latest triggerState
+		select {
+		case latest = <-changes:
+		case <-stop:
+			return
+		}
+		previous := latest.Previous
+		deadline := time.After(max)
+		timer := time.NewTimer(quiet)
+
+	wait:
+		for {
+			select {
+			case latest = <-changes:
+				timer.Reset(quiet)
+			case <-timer.C:
+				break wait
+			case <-deadline:
+				timer.Stop()
+				break wait
+			}
+		}
+
+		latest.Previous = previous
+		if err := pushTriggerEvent(t, latest); err != nil {
+			log.Errorf("Failed to push event triggered by %s(%s)", t.Trigger, err)
+		}
+	}
+}
+
+//	Push synthetic event that executes triggered task
+func pushTriggerEvent(t *task.Task, state triggerState) error {
+	name := TRIGGER_EVENT_PREFIX + t.Pattern + ":" + t.Name
+	payload, err := json.Marshal(Payload{Token: config.Token, Params: state.Params})
+	if err != nil {
+		return err
+	}
+
+	event := api.UserEvent{
+		ID:      triggerEventID(name, state),
+		Name:    name,
+		Payload: payload,
+	}
+	log.Infof("Task %s in %s has been triggered by %s", t.Name, t.Pattern, t.Trigger)
+	return pushEvents([]api.UserEvent{event})
+}
+
+//	Event ID is derived from change of watched data to push a single event when some nodes detect same change
+//	Fingerprint before change is included because fingerprint repeats when data returns to empty(deleted key or no instances)
+//	Index of watch isn't included because each node may get different index for same data
+func triggerEventID(name string, state triggerState) string {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s/%s/%s", name, state.Previous, state.Fingerprint)))
+	return fmt.Sprintf("%x", hash[:16])
+}
+
+func isTriggerEvent(name string) bool {
+	return strings.HasPrefix(name, TRIGGER_EVENT_PREFIX)
+}
+
+//	Return event that executes triggered task from name of synthetic event(trigger:<pattern>:<task>)
+func (scheduler *Scheduler) triggerEvents(name string) Events {
+	items := strings.SplitN(strings.TrimPrefix(name, TRIGGER_EVENT_PREFIX), ":", 2)
+	if len(items) != 2 {
+		return nil
+	}
+
+	s, found := scheduler.current()[items[0]]
+	if !found {
+		return nil
+	}
+	t, found := s.Tasks[items[1]]
+	if !found || t.Trigger == "" {
+		return nil
+	}
+
+	return Events{
+		Event{
+			Path:        s.path,
+			Pattern:     items[0],
+			Name:        name,
+			Description: fmt.Sprintf("Triggered by %s", t.Trigger),
+			Priority:    50,
+			Task:        t.Name,
+		},
+	}
+}
@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTriggerEventID(t *testing.T) {
+	name := "trigger:app:restart"
+	id := triggerEventID(name, triggerState{Index: 10, Previous: "5", Fingerprint: "8"})
+
+	cases := []struct {
+		name  string
+		state triggerState
+		same  bool
+	}{
+		{"other index", triggerState{Index: 12, Previous: "5", Fingerprint: "8"}, true},
+		{"other fingerprint", triggerState{Index: 10, Previous: "5", Fingerprint: "9"}, false},
+		{"other previous", triggerState{Index: 10, Previous: "6", Fingerprint: "8"}, false},
+	}
+	for _, c := range cases {
+		if actual := triggerEventID(name, c.state); (actual == id) != c.same {
+			t.Errorf("%s: triggerEventID() = %s, same as %s is %v", c.name, actual, id, !c.same)
+		}
+	}
+	if triggerEventID("trigger:app:backup", triggerState{Index: 10, Previous: "5", Fingerprint: "8"}) == id {
+		t.Errorf("triggerEventID() returns same ID for other task")
+	}
+}
+
+func TestTriggerWatch(t *testing.T) {
+	c := startFakeConsul()
+	c.put("app/version", "1")
+
+	changes := make(chan triggerState)
+	stop := make(chan struct{})
+	defer close(stop)
+	go (&Trigger{Type: "kv", Key: "app/version"}).watch(changes, stop)
+
+	receive := func() triggerState {
+		select {
+		case state := <-changes:
+			return state
+		case <-time.After(5 * time.Second):
+			t.Fatalf("watch() doesn't send change")
+		}
+		return triggerState{}
+	}
+
+	//	Deleting key twice sends different changes, so they are pushed as different events
+	var ids []string
+	for _, value := range []string{"2", "", "3", ""} {
+		time.Sleep(300 * time.Millisecond)
+		if value == "" {
+			c.mu.Lock()
+			delete(c.kvs, "app/version")
+			c.index += 1
+			c.mu.Unlock()
+		} else {
+			c.put("app/version", value)
+		}
+		state := receive()
+		if state.Params["trigger.value"] != value {
+			t.Errorf("watch() sends value %q, want %q", state.Params["trigger.value"], value)
+		}
+		ids = append(ids, triggerEventID("trigger:app:restart", state))
+	}
+	for i := range ids {
+		for j := i + 1; j < len(ids); j++ {
+			if ids[i] == ids[j] {
+				t.Errorf("Change %d and %d have same event ID %s", i, j, ids[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"metronome/config"
+	"metronome/operation"
+	"metronome/task"
+	"metronome/util"
+	"reflect"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+)
+
+//	Problem that has been found in task.yml
+type Diagnostic struct {
+	Severity string
+	Path     string
+	Line     int
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", d.Path, d.Line, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Path, d.Severity, d.Message)
+}
+
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Len() int {
+	return len(ds)
+}
+
+func (ds Diagnostics) Swap(i, j int) {
+	ds[i], ds[j] = ds[j], ds[i]
+}
+
+//	Sort diagnostics by position in file
+func (ds Diagnostics) Less(i, j int) bool {
+	if ds[i].Path != ds[j].Path {
+		return ds[i].Path < ds[j].Path
+	}
+	return ds[i].Line < ds[j].Line
+}
+
+func (ds Diagnostics) HasError() bool {
+	for _, d := range ds {
+		if d.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+//	Variables that are set by metronome when task or notification runs
+var builtinVariables = []string{"event.id", "event.name", "node", "role"}
+var notificationVariables = []string{"status", "task.name", "task.no", "pattern", "started_at", "finished_at", "duration"}
+
+//	Raw structure of task.yml to check values before they are decoded to operations
+type rawSchedule struct {
+	Events map[string]map[string]json.RawMessage
+	Tasks  map[string]struct {
+		Operations []map[string]json.RawMessage
+	}
+	Notifications []json.RawMessage
+}
+
+//	Collect diagnostics of task.yml with position of node
+type validator struct {
+	scheduler     *Scheduler
+	userVariables map[string]string
+	locators      map[string]*yamlLocator
+	diagnostics   Diagnostics
+
+	//	Some task.yml couldn't be loaded by error
+	failed bool
+}
+
+func newValidator(vars map[string]string) *validator {
+	return &validator{
+		scheduler:     &Scheduler{schedules: make(map[string]Schedule)},
+		userVariables: vars,
+		locators:      make(map[string]*yamlLocator),
+	}
+}
+
+func (v *validator) report(severity string, path string, node string, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: severity,
+		Path:     path,
+		Line:     v.locators[path].Line(node),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+//	Validate all task.yml when execute metronome with validate subcommand
+//	Each file is loaded separately so that problems in all files are reported at once
+func Validate() (string, error) {
+	v := newValidator(config.UserVariables)
+	v.load()
+	v.validate()
+	sort.Stable(v.diagnostics)
+
+	var lines []string
+	for _, d := range v.diagnostics {
+		lines = append(lines, d.String())
+	}
+	lines = append(lines, fmt.Sprintf("%d problem(s) found\n", len(v.diagnostics)))
+
+	if v.diagnostics.HasError() {
+		return strings.Join(lines, "\n"), errors.New("Some errors are found in task.yml")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+//	Load and validate all task.yml, warnings are logged and errors are returned together
+//	Agent uses it on start and reload to check task.yml in the same way as validate subcommand
+//	Without strict, errors are only logged unless they prevent any task.yml from being loaded
+//	User variables are snapshotted into each schedule, so templates never read variables that are being reloaded
+func loadSchedules(vars map[string]string, strict bool) (map[string]Schedule, error) {
+	v := newValidator(vars)
+	v.load()
+	v.validate()
+	sort.Stable(v.diagnostics)
+
+	var errs []string
+	for _, d := range v.diagnostics {
+		if d.Severity == "error" {
+			errs = append(errs, d.String())
+		} else {
+			log.Warn(d.String())
+		}
+	}
+	if len(errs) > 0 && (strict || v.failed) {
+		return nil, errors.New(fmt.Sprintf("Some errors are found in task.yml\n\t%s", strings.Join(errs, "\n\t")))
+	}
+	for _, e := range errs {
+		log.Error(e)
+	}
+	for _, s := range v.scheduler.schedules {
+		s.applyEnvironments()
+	}
+	return v.scheduler.schedules, nil
+}
+
+func (v *validator) load() {
+	for _, path := range config.Files {
+		if path == "" {
+			continue
+		}
+		if !util.Exists(path) {
+			v.report("warning", path, "", "file does not found")
+			continue
+		}
+		log.Debugf("Load %s", path)
+		pattern := patternName(path)
+		if s, found := v.scheduler.schedules[pattern]; found {
+			v.report("error", path, "", "pattern %s is also defined in %s", pattern, s.path)
+			v.failed = true
+			continue
+		}
+
+		j, raw, ok := v.read(path)
+		if !ok {
+			v.failed = true
+			continue
+		}
+		reported := len(v.diagnostics)
+		v.validateOperations(path, raw)
+		v.validatePriorities(path, raw)
+
+		var schedule Schedule
+		schedule.Default = taskDefault()
+		if err := json.Unmarshal(j, &schedule); err != nil {
+			//	Problems in operations have been reported with position already
+			if !v.diagnostics[reported:].HasError() {
+				v.report("error", path, "", "failed to unmarshal task.yml(%s)", err)
+			}
+			v.failed = true
+			continue
+		}
+		schedule.PostUnmarshal(path, pattern)
+		schedule.userVariables = v.userVariables
+
+		//	Check operations in imported libraries with their positions before importing them
+		libraries := make(map[string]rawSchedule)
+		for _, i := range schedule.Imports {
+			libraryPath := schedule.importPath(i)
+			if _, library, ok := v.read(libraryPath); ok {
+				v.validateOperations(libraryPath, library)
+				libraries[libraryPath] = library
+			}
+		}
+		if err := schedule.Import(); err != nil {
+			if !v.diagnostics[reported:].HasError() {
+				v.report("error", path, "imports", "%s", err)
+			}
+			v.failed = true
+			continue
+		}
+
+		v.scheduler.schedules[pattern] = schedule
+		v.validateVariables(schedule, path, raw)
+		for _, libraryPath := range sortedKeys(libraries) {
+			v.validateVariables(schedule, libraryPath, libraries[libraryPath])
+		}
+	}
+}
+
+//	Read YAML file and decode it to raw structure, and report problem when failed
+func (v *validator) read(path string) ([]byte, rawSchedule, bool) {
+	var raw rawSchedule
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		v.report("error", path, "", "failed to read file(%s)", err)
+		return nil, raw, false
+	}
+	v.locators[path] = newYAMLLocator(d)
+
+	j, err := yaml.YAMLToJSON(d)
+	if err != nil {
+		v.report("error", path, "", "failed to parse YAML(%s)", err)
+		return nil, raw, false
+	}
+	if err := json.Unmarshal(j, &raw); err != nil {
+		v.report("error", path, "", "failed to parse task.yml(%s)", err)
+		return nil, raw, false
+	}
+	return j, raw, true
+}
+
+func (v *validator) validate() {
+	var patterns []string
+	for k := range v.scheduler.schedules {
+		patterns = append(patterns, k)
+	}
+	sort.Strings(patterns)
+
+	used := make(map[*task.Task]bool)
+	for _, pattern := range patterns {
+		s := v.scheduler.schedules[pattern]
+		v.validateTaskReferences(s, used)
+		v.validateFilters(s)
+		v.validateNotifications(s)
+		v.validateEnvironments(s)
+	}
+	for _, pattern := range patterns {
+		v.validateUnusedTasks(v.scheduler.schedules[pattern], used)
+	}
+}
+
+//	Report unknown operation types, and fields of operation that are unknown or have wrong type
+func (v *validator) validateOperations(path string, raw rawSchedule) {
+	for _, name := range sortedKeys(raw.Tasks) {
+		for i, m := range raw.Tasks[name].Operations {
+			node := fmt.Sprintf("tasks.%s.operations[%d]", name, i)
+			if len(m) != 1 {
+				v.report("error", path, node, "%s has multiple types", node)
+				continue
+			}
+			for kind, value := range m {
+				if _, found := operation.Operations[kind]; !found {
+					v.report("error", path, node+"."+kind, "%s has unknown operation type %s", node, kind)
+					continue
+				}
+				fatal := false
+				for _, err := range operation.CheckFields(kind, value) {
+					severity := "error"
+					if err.Unknown && config.AllowUnknownFields {
+						severity = "warning"
+					} else {
+						fatal = true
+					}
+					v.report(severity, path, node+"."+kind+"."+err.Field, "%s.%s.%s", node, kind, err)
+				}
+				if fatal {
+					continue
+				}
+
+				//	Check required fields after operation has been decoded
+				o, err := operation.Operations[kind](value)
+				if err == nil {
+					err = o.Validate()
+				}
+				if err != nil {
+					v.report("error", path, node+"."+kind, "%s.%s %s", node, kind, err)
+				}
+			}
+		}
+	}
+}
+
+//	Priority must be integer from 0 to 100, event with smaller priority runs first
+func (v *validator) validatePriorities(path string, raw rawSchedule) {
+	for _, name := range sortedKeys(raw.Events) {
+		d, found := raw.Events[name]["priority"]
+		if !found {
+			continue
+		}
+		node := fmt.Sprintf("events.%s.priority", name)
+		var priority int
+		if err := json.Unmarshal(d, &priority); err != nil {
+			v.report("error", path, node, "%s must be integer(%s)", node, d)
+			continue
+		}
+		if priority < 0 || priority > 100 {
+			v.report("error", path, node, "%s must be from 0 to 100(%d)", node, priority)
+		}
+	}
+}
+
+//	Report event tasks that refer undefined task including "pattern:task" in other pattern
+func (v *validator) validateTaskReferences(s Schedule, used map[*task.Task]bool) {
+	for _, name := range sortedKeys(s.Events) {
+		e := s.Events[name]
+		refs := make(map[string]EventTask)
+		if e.Task != "" {
+			refs[fmt.Sprintf("events.%s", name)] = EventTask{Task: e.Task}
+		}
+		for i, et := range e.OrderedTasks {
+			refs[fmt.Sprintf("events.%s.ordered_tasks[%d]", name, i)] = et
+		}
+
+		for _, node := range sortedKeys(refs) {
+			et := refs[node]
+			_, t, found := v.scheduler.findTask(s.pattern, et.Task)
+			if !found {
+				v.report("error", s.path, node+".task", "%s.task refers undefined task %s", node, et.Task)
+				continue
+			}
+			used[t] = true
+			v.validateArguments(s.path, node, et, t)
+		}
+	}
+}
+
+//	Report values in with that aren't declared in params of task, and required params without value
+func (v *validator) validateArguments(path string, node string, et EventTask, t *task.Task) {
+	for _, k := range sortedKeys(et.With) {
+		if _, found := t.Params[k]; !found {
+			v.report("error", path, node+".with."+k, "%s.with passes %s but task %s doesn't have param %s", node, k, et.Task, k)
+		}
+	}
+	for _, k := range sortedKeys(t.Params) {
+		if _, found := et.With[k]; !found && t.Params[k].Required {
+			v.report("error", path, node, "%s doesn't pass required param %s of task %s", node, k, et.Task)
+		}
+	}
+}
+
+//	Warn tasks that are never used, tasks in imported libraries are excluded because they are shared
+func (v *validator) validateUnusedTasks(s Schedule, used map[*task.Task]bool) {
+	for _, name := range sortedKeys(s.Tasks) {
+		t := s.Tasks[name]
+		if !used[t] && t.Trigger == "" && t.Path == s.path {
+			node := fmt.Sprintf("tasks.%s", name)
+			v.report("warning", s.path, node, "%s is not used by any event", node)
+		}
+	}
+}
+
+//	Warn when operation or notification refers variable that is defined nowhere
+//	It may be passed as event parameter, so it isn't an error
+func (v *validator) validateVariables(s Schedule, path string, raw rawSchedule) {
+	known := make(map[string]bool)
+	for _, k := range builtinVariables {
+		known[k] = true
+	}
+	for k := range s.Variables {
+		known[k] = true
+	}
+	for k := range s.userVariables {
+		known[k] = true
+	}
+
+	for _, name := range sortedKeys(raw.Tasks) {
+		vars := make(map[string]bool)
+		for k := range known {
+			vars[k] = true
+		}
+		t, found := s.Tasks[name]
+		if !found {
+			continue
+		}
+		for k := range t.Params {
+			vars[k] = true
+		}
+		//	consul-kvs get stores value to variable for following operations
+		for _, o := range t.Operations {
+			if kvs, ok := o.(*operation.ConsulKVSOperation); ok && kvs.Action == "get" {
+				vars[kvs.Name] = true
+			}
+		}
+		for i, m := range raw.Tasks[name].Operations {
+			node := fmt.Sprintf("tasks.%s.operations[%d]", name, i)
+			for kind, value := range m {
+				v.checkVariables(path, node+"."+kind, value, vars)
+			}
+		}
+	}
+
+	vars := make(map[string]bool)
+	for k := range known {
+		vars[k] = true
+	}
+	for _, k := range notificationVariables {
+		vars[k] = true
+	}
+	for i, value := range raw.Notifications {
+		v.checkVariables(path, fmt.Sprintf("notifications[%d]", i), value, vars)
+	}
+}
+
+func (v *validator) checkVariables(path string, node string, value json.RawMessage, vars map[string]bool) {
+	var src interface{}
+	if err := json.Unmarshal(value, &src); err != nil {
+		return
+	}
+	//	Undefined variable fails task in strict mode
+	severity := "warning"
+	if config.StrictVariables {
+		severity = "error"
+	}
+
+	reported := make(map[string]bool)
+	for _, s := range stringValues(src) {
+		names, err := util.TemplateVariables(s)
+		if err != nil {
+			//	Invalid action is left as it is unless strict mode, but broken {{if}} always fails
+			if _, ok := err.(*util.ActionError); ok {
+				v.report(severity, path, node, "%s has invalid template(%s)", node, err)
+			} else {
+				v.report("error", path, node, "%s has invalid template(%s)", node, err)
+			}
+			continue
+		}
+		for _, name := range names {
+			if vars[name] || reported[name] || strings.HasPrefix(name, "config.") || strings.HasPrefix(name, "trigger.") {
+				continue
+			}
+			reported[name] = true
+			v.report(severity, path, node, "%s refers undefined variable {{%s}}, it must be passed as event parameter", node, name)
+		}
+	}
+}
+
+//	Return all strings in value that is decoded from JSON
+func stringValues(src interface{}) []string {
+	switch src := src.(type) {
+	case string:
+		return []string{src}
+	case []interface{}:
+		var results []string
+		for _, e := range src {
+			results = append(results, stringValues(e)...)
+		}
+		return results
+	case map[string]interface{}:
+		var results []string
+		for _, e := range src {
+			results = append(results, stringValues(e)...)
+		}
+		return results
+	default:
+		return nil
+	}
+}
+
+//	Warn when filter on event task contradicts filter on target task
+func (v *validator) validateFilters(s Schedule) {
+	for _, name := range sortedKeys(s.Events) {
+		for i, et := range s.Events[name].OrderedTasks {
+			node := fmt.Sprintf("events.%s.ordered_tasks[%d]", name, i)
+			f := v.scheduler.taskFilter(s.pattern, et.Task)
+			if et.Service != "" && f.Service != "" && et.Service != f.Service {
+				v.report("warning", s.path, node+".service", "%s filters service %s but task %s filters service %s", node, et.Service, et.Task, f.Service)
+			}
+			if et.Tag != "" && f.Tag != "" && et.Tag != f.Tag {
+				v.report("warning", s.path, node+".tag", "%s filters tag %s but task %s filters tag %s", node, et.Tag, et.Task, f.Tag)
+			}
+		}
+	}
+}
+
+//	Report notification that can't be delivered or never matches
+func (v *validator) validateNotifications(s Schedule) {
+	for i, n := range s.Notifications {
+		node := fmt.Sprintf("notifications[%d]", i)
+		if n.URL == "" {
+			v.report("error", s.path, node, "%s doesn't have url", node)
+		}
+		if n.Retry != nil && *n.Retry < 0 {
+			v.report("error", s.path, node+".retry", "%s has negative retry(%d)", node, *n.Retry)
+		}
+		for _, on := range n.On {
+			if on != "event" && on != "task" {
+				v.report("error", s.path, node+".on", "%s has unknown on(%s), it must be event or task", node, on)
+			}
+		}
+	}
+}
+
+//	Report environment that can't be rendered(undefined variable in strict mode), it isn't passed to commands
+func (v *validator) validateEnvironments(s Schedule) {
+	for _, k := range sortedKeys(s.Environments) {
+		if _, err := s.resolveEnvironment(k); err != nil {
+			v.report("error", s.path, "environments."+k, "environments.%s can't be rendered(%s)", k, err)
+		}
+	}
+}
+
+//	Return keys of map in sorted order to report diagnostics in stable order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
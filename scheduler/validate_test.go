@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"metronome/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//	Write task.yml of each pattern under temporary directory and return the directory
+func writeTaskFiles(t *testing.T, sources map[string]string) string {
+	dir, err := ioutil.TempDir("", "metronome")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory(%s)", err)
+	}
+	for pattern, src := range sources {
+		path := filepath.Join(dir, pattern, "task.yml")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write %s(%s)", path, err)
+		}
+	}
+	return dir
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{
+		"app": `events:
+  deploy:
+    priority: 200
+    task: restart
+  backup:
+    ordered_tasks:
+      - task: undefined
+tasks:
+  restart:
+    operations:
+      - echo: "restart {{unknown}}"
+  unused:
+    operations:
+      - echo: unused
+`,
+		"db": `events:
+  backup:
+    task: backup
+tasks:
+  backup:
+    operations:
+      - echo: "backup {{role}}"
+`,
+		"other/db": `tasks: {}
+`,
+		"web": `events:
+  deploy:
+    ordered_tasks:
+      - task: restart
+        service: web
+        tag: primary
+tasks:
+  restart:
+    service: api
+    tag: secondary
+    operations:
+      - echo: restart
+`,
+	})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+
+	cases := []struct {
+		name     string
+		files    []string
+		expected string
+		err      bool
+	}{
+		{"valid", []string{filepath.Join(dir, "db/task.yml")}, "0 problem(s) found\n", false},
+		{"problems", []string{filepath.Join(dir, "app/task.yml"), filepath.Join(dir, "db/task.yml")}, `app/task.yml:3: error: events.deploy.priority must be from 0 to 100(200)
+app/task.yml:7: error: events.backup.ordered_tasks[0].task refers undefined task undefined
+app/task.yml:11: warning: tasks.restart.operations[0].echo refers undefined variable {{unknown}}, it must be passed as event parameter
+app/task.yml:12: warning: tasks.unused is not used by any event
+4 problem(s) found
+`, true},
+		{"contradicting filters", []string{filepath.Join(dir, "web/task.yml")}, `web/task.yml:5: warning: events.deploy.ordered_tasks[0] filters service web but task restart filters service api
+web/task.yml:6: warning: events.deploy.ordered_tasks[0] filters tag primary but task restart filters tag secondary
+2 problem(s) found
+`, false},
+		{"missing file", []string{filepath.Join(dir, "missing/task.yml")}, "missing/task.yml: warning: file does not found\n1 problem(s) found\n", false},
+		{"duplicate pattern", []string{filepath.Join(dir, "db/task.yml"), filepath.Join(dir, "other/db/task.yml")}, "other/db/task.yml: error: pattern db is also defined in db/task.yml\n1 problem(s) found\n", true},
+	}
+	for _, c := range cases {
+		config.Files = c.files
+		actual, err := Validate()
+		if (err != nil) != c.err {
+			t.Errorf("%s: Validate() returns error %v, want error %v", c.name, err, c.err)
+		}
+		actual = strings.Replace(actual, dir+"/", "", -1)
+		if actual != c.expected {
+			t.Errorf("%s: Validate() = %q, want %q", c.name, actual, c.expected)
+		}
+	}
+}
+
+func TestLoadSchedules(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{
+		"app": `events:
+  deploy:
+    task: undefined
+`,
+		"db":       testTaskYAML,
+		"other/db": testTaskYAML,
+		"broken":   "events: [",
+	})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+
+	cases := []struct {
+		name     string
+		files    []string
+		strict   bool
+		patterns int
+		err      bool
+	}{
+		{"valid", []string{"db/task.yml"}, true, 1, false},
+		{"undefined task", []string{"app/task.yml", "db/task.yml"}, false, 2, false},
+		{"undefined task with strict", []string{"app/task.yml", "db/task.yml"}, true, 0, true},
+		{"duplicate pattern", []string{"db/task.yml", "other/db/task.yml"}, false, 0, true},
+		{"broken file", []string{"broken/task.yml", "db/task.yml"}, false, 0, true},
+		{"missing file", []string{"missing/task.yml", "db/task.yml"}, true, 1, false},
+	}
+	for _, c := range cases {
+		config.Files = nil
+		for _, f := range c.files {
+			config.Files = append(config.Files, filepath.Join(dir, f))
+		}
+		schedules, err := loadSchedules(nil, c.strict)
+		if (err != nil) != c.err {
+			t.Errorf("%s: loadSchedules() returns error %v, want error %v", c.name, err, c.err)
+		}
+		if len(schedules) != c.patterns {
+			t.Errorf("%s: loadSchedules() loads %d patterns, want %d", c.name, len(schedules), c.patterns)
+		}
+	}
+}
+
+func TestValidateEnvironments(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{"app": `environments:
+  TOKEN: "{{undefined}}"
+  NAME: "{{name}}"
+variables:
+  name: web
+events:
+  env:
+    task: env
+tasks:
+  env:
+    operations:
+      - execute:
+          script: "echo $NAME-$TOKEN"
+`})
+	defer os.RemoveAll(dir)
+	defer func(files []string) { config.Files = files }(config.Files)
+	defer func(strict bool) { config.StrictVariables = strict }(config.StrictVariables)
+	config.Files = []string{filepath.Join(dir, "app/task.yml")}
+
+	//	Undefined variable is left as it is unless strict mode
+	config.StrictVariables = false
+	if actual, err := Validate(); err != nil || !strings.HasSuffix(actual, "0 problem(s) found\n") {
+		t.Errorf("Validate() = (%q, %v), want no problems", actual, err)
+	}
+
+	config.StrictVariables = true
+	actual, err := Validate()
+	expected := "app/task.yml:2: error: environments.TOKEN can't be rendered"
+	if err == nil || !strings.Contains(strings.Replace(actual, dir+"/", "", -1), expected) {
+		t.Errorf("Validate() = (%q, %v), want %q", actual, err, expected)
+	}
+
+	//	Environment that can't be rendered isn't passed to commands
+	schedules, err := loadSchedules(nil, false)
+	if err != nil {
+		t.Fatalf("loadSchedules() returns error: %s", err)
+	}
+	out, err := schedules["app"].Tasks["env"].Operations[0].Run(log.NewEntry(log.New()), nil)
+	if err != nil {
+		t.Fatalf("Run() returns error: %s", err)
+	}
+	if actual := strings.TrimSpace(out.Stdout); actual != "web-" {
+		t.Errorf("Command gets %q, want %q", actual, "web-")
+	}
+	if _, err := loadSchedules(nil, true); err == nil {
+		t.Errorf("loadSchedules() with strict doesn't return error")
+	}
+}
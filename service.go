@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"metronome/config"
 	"metronome/scheduler"
 	"metronome/util"
 	"os"
@@ -28,7 +30,7 @@ func NewService(name, description string, dependencies []string) (*Service, erro
 }
 
 func (service *Service) Manage() (string, error) {
-	usage := "Usage: metronome install | remove | start | stop | status | agent\n"
+	usage := "Usage: metronome install | remove | start | stop | status | agent | validate | logs | gc | history | fire | cancel | pause | resume | queue | audit | report\n"
 
 	if flag.NArg() > 0 {
 		switch flag.Args()[0] {
@@ -41,6 +43,9 @@ func (service *Service) Manage() (string, error) {
 		case "stop":
 			return service.Stop()
 		case "status":
+			if flag.NArg() > 1 {
+				return status(flag.Args()[1:])
+			}
 			return service.Status()
 		case "agent":
 			return agent()
@@ -48,6 +53,30 @@ func (service *Service) Manage() (string, error) {
 			return scheduler.Push()
 		case "dispatch":
 			return dispatch(flag.Args()[1])
+		case "logs":
+			return logs(flag.Args()[1:])
+		case "fire":
+			return fire(flag.Args()[1:])
+		case "cancel":
+			return cancel(flag.Args()[1:])
+		case "pause":
+			return pause(true)
+		case "resume":
+			return pause(false)
+		case "queue":
+			return queues()
+		case "history":
+			return history(flag.Args()[1:])
+		case "gc":
+			return gc(flag.Args()[1:])
+		case "audit":
+			return auditLog(flag.Args()[1:])
+		case "report":
+			return report(flag.Args()[1:])
+		case "validate":
+			result, err := scheduler.Validate()
+			log.SetFormatter(&util.SimpleFormatter{})
+			return result, err
 		case "version":
 			log.SetFormatter(&util.SimpleFormatter{})
 			return fmt.Sprintf("metronome %s\n", Version), nil
@@ -60,23 +89,57 @@ func (service *Service) Manage() (string, error) {
 }
 
 func agent() (string, error) {
+	if err := setupLogOutputs(); err != nil {
+		return "Failed to setup log outputs", err
+	}
+
 	time.Sleep(5 * time.Second)
 	scheduler, err := scheduler.NewScheduler()
 	if err != nil {
 		return "Failed to create scheduler", err
 	}
+	if config.APIAddress != "" {
+		if err := scheduler.ServeAPI(config.APIAddress); err != nil {
+			return "Failed to serve HTTP API", err
+		}
+	}
 	go scheduler.Run()
 
-	return waitSignal()
+	return waitSignal(scheduler)
 }
 
-func waitSignal() (string, error) {
+//	Send agent log to rotating file and syslog in addition to STDOUT
+func setupLogOutputs() error {
+	if config.LogFile != "" {
+		f, err := util.NewRotatingFile(config.LogFile, int64(config.LogFileMaxSize)*1024*1024, time.Duration(config.LogFileMaxAge)*time.Hour, config.LogFileBackups)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(io.MultiWriter(os.Stdout, f))
+	}
+	if config.Syslog {
+		hook, err := util.NewSyslogHook("metronome", log.StandardLogger().Formatter)
+		if err != nil {
+			return err
+		}
+		log.AddHook(hook)
+	}
+	return nil
+}
+
+//	Reload schedules on SIGHUP and exit on other signals
+func waitSignal(s *scheduler.Scheduler) (string, error) {
 	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	for {
 		select {
 		case killSignal := <-interrupt:
+			if killSignal == syscall.SIGHUP {
+				log.Info("Reload schedules by SIGHUP")
+				s.Reload()
+				continue
+			}
 			if killSignal == os.Interrupt {
 				return "Daemon was interrupted by system signal", nil
 			}
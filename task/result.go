@@ -0,0 +1,86 @@
+package task
+
+import (
+	"metronome/operation"
+	"metronome/util"
+	"sync"
+	"time"
+)
+
+//	Max bytes of STDOUT and STDERR in each operation result, head of output is truncated when exceeded
+const OUTPUT_MAX_SIZE = 4096
+
+//	Result of each operation in task
+type OperationResult struct {
+	Index       int
+	Type        string
+	Description string `json:",omitempty"`
+	Status      string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	ExitCode    int    `json:",omitempty"`
+	Stdout      string `json:",omitempty"`
+	Stderr      string `json:",omitempty"`
+	Error       string `json:",omitempty"`
+}
+
+//	Collect operation results while operations are running in other goroutine
+type operationRecorder struct {
+	mu      sync.Mutex
+	results []OperationResult
+}
+
+func (r *operationRecorder) start(index int, o operation.Operation, vars map[string]string, status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, OperationResult{
+		Index:       index,
+		Type:        o.Type(),
+		Description: o.Describe(vars),
+		Status:      status,
+		StartedAt:   time.Now(),
+	})
+}
+
+//	Finish last operation with output and error
+func (r *operationRecorder) finish(status string, output *operation.CommandOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.results) == 0 {
+		return
+	}
+	result := &r.results[len(r.results)-1]
+	result.Status = status
+	result.FinishedAt = time.Now()
+	if output != nil {
+		result.Stdout = truncateOutput(output.Stdout)
+		result.Stderr = truncateOutput(output.Stderr)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = util.ExitCode(err)
+	}
+}
+
+//	Return copy of results, and mark running operation as timeout when task has expired
+func (r *operationRecorder) list(expired bool) []OperationResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]OperationResult, len(r.results))
+	copy(results, r.results)
+	for i := range results {
+		if expired && results[i].Status == "inprogress" {
+			results[i].Status = "timeout"
+			results[i].FinishedAt = time.Now()
+		}
+	}
+	return results
+}
+
+//	Keep tail of output because reason of failure is usually written at last
+func truncateOutput(s string) string {
+	if len(s) <= OUTPUT_MAX_SIZE {
+		return s
+	}
+	return "...(truncated)\n" + s[len(s)-OUTPUT_MAX_SIZE:]
+}
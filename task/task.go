@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"metronome/metrics"
 	"metronome/operation"
 	"metronome/util"
 	"time"
@@ -11,6 +12,12 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
+var (
+	ErrSkipped = errors.New("Task has been skipped because when condition isn't satisfied")
+)
+
+var operationDuration = metrics.NewHistogram("metronome_operation_duration_seconds", "Duration of operation by type.", metrics.DefaultBuckets, "type", "status")
+
 type Task struct {
 	Path        string
 	Pattern     string
@@ -18,15 +25,49 @@ type Task struct {
 	Trigger     string
 	Description string
 	Timeout     int32
+	When        string
 	Filter      Filter
+	Debounce    Debounce
+	Params      Params
 	Operations  []operation.Operation
 }
 
+//	Parameter of task that is passed by with in ordered_tasks, it is required when default is null
+type Param struct {
+	Default  string
+	Required bool
+}
+
+type Params map[string]Param
+
+func (p *Params) UnmarshalJSON(d []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(d, &raw); err != nil {
+		return err
+	}
+	*p = make(Params)
+	for k, v := range raw {
+		s, ok := util.ScalarString(v)
+		if !ok {
+			return errors.New(fmt.Sprintf("Default value of param %s must be scalar value", k))
+		}
+		(*p)[k] = Param{Default: s, Required: v == nil}
+	}
+	return nil
+}
+
 type Filter struct {
 	Service string
 	Tag     string
 }
 
+//	Wait for changes of trigger to settle before triggering task
+//	Quiet is the period without changes and Max is the longest delay from first change(seconds)
+type Debounce struct {
+	Quiet int32
+	Max   int32
+}
+
 func (t *Task) UnmarshalJSON(d []byte) error {
 	m := make(map[string]json.RawMessage)
 	u := &util.UnmarshalContext{}
@@ -35,7 +76,12 @@ func (t *Task) UnmarshalJSON(d []byte) error {
 	u.Unmarshal([]byte(m["trigger"]), &t.Trigger)
 	u.Unmarshal([]byte(m["description"]), &t.Description)
 	u.Unmarshal([]byte(m["timeout"]), &t.Timeout)
+	u.Unmarshal([]byte(m["when"]), &t.When)
 	u.Unmarshal([]byte(m["filter"]), &t.Filter)
+	u.Unmarshal([]byte(m["service"]), &t.Filter.Service)
+	u.Unmarshal([]byte(m["tag"]), &t.Filter.Tag)
+	u.Unmarshal([]byte(m["debounce"]), &t.Debounce)
+	u.Unmarshal([]byte(m["params"]), &t.Params)
 
 	if u.Err != nil {
 		return u.Err
@@ -44,6 +90,28 @@ func (t *Task) UnmarshalJSON(d []byte) error {
 	return operation.UnmarshalOperations([]byte(m["operations"]), &t.Operations)
 }
 
+//	Resolve arguments of task from values passed by with and default values of params
+func (t *Task) Arguments(with map[string]string) (map[string]string, error) {
+	for k := range with {
+		if _, found := t.Params[k]; !found {
+			return nil, errors.New(fmt.Sprintf("Task %s doesn't have param %s", t.Name, k))
+		}
+	}
+
+	args := make(map[string]string)
+	for k, p := range t.Params {
+		if v, found := with[k]; found {
+			args[k] = v
+			continue
+		}
+		if p.Required {
+			return nil, errors.New(fmt.Sprintf("Param %s of task %s is required", k, t.Name))
+		}
+		args[k] = p.Default
+	}
+	return args, nil
+}
+
 func (t *Task) SetPattern(path string, pattern string) {
 	t.Path = path
 	t.Pattern = pattern
@@ -52,42 +120,87 @@ func (t *Task) SetPattern(path string, pattern string) {
 	}
 }
 
-func (t *Task) Run(vars map[string]string) error {
-	log.Infof("-- Task %s has started", t.Name)
+//	Set environment variables that are passed to commands of all operations
+func (t *Task) SetEnvironments(env []string) {
+	for _, o := range t.Operations {
+		o.SetEnvironments(env)
+	}
+}
+
+//	Run operations in task and return result of each operation
+func (t *Task) Run(logger *log.Entry, vars map[string]string) ([]OperationResult, error) {
+	//	Skip task when conditional expression is false
+	ok, err := util.Evaluate(t.When, vars)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		logger.Infof("-- Task %s has been skipped by condition(%s)", t.Name, t.When)
+		return nil, ErrSkipped
+	}
+
+	logger.Infof("-- Task %s has started", t.Name)
 	ch := make(chan error)
 	timeout := make(chan bool)
+	recorder := &operationRecorder{}
 
-	go t.runWithTimeout(vars, ch, timeout)
+	go t.runWithTimeout(logger, vars, recorder, ch, timeout)
 
 	select {
 	case err := <-ch:
 		if err != nil {
-			log.Errorf("-- Task %s has failed", t.Name)
-			return err
+			logger.Errorf("-- Task %s has failed", t.Name)
+			return recorder.list(false), err
 		}
 	case <-time.After(time.Duration(t.Timeout) * time.Second):
-		log.Errorf("-- Task %s has expired", t.Name)
+		logger.Errorf("-- Task %s has expired", t.Name)
 		close(timeout)
-		return errors.New("Timeout expired while executing task")
+		return recorder.list(true), errors.New("Timeout expired while executing task")
 	}
-	log.Infof("-- Task %s has finished successfully", t.Name)
-	return nil
+	logger.Infof("-- Task %s has finished successfully", t.Name)
+	return recorder.list(false), nil
 }
 
-func (t *Task) runWithTimeout(vars map[string]string, ch chan error, timeout <-chan bool) {
-	for _, o := range t.Operations {
-		log.Infof("---- Operation %s has started", o.String())
-		if err := o.Run(vars); err != nil {
-			log.Errorf("---- Operation %s in %s has failed", o.String(), t.Name)
+func (t *Task) runWithTimeout(logger *log.Entry, vars map[string]string, recorder *operationRecorder, ch chan error, timeout <-chan bool) {
+	for i, o := range t.Operations {
+		opLogger := logger.WithField("operation", o.Type())
+
+		//	Skip operation when conditional expression is false
+		ok, err := util.Evaluate(o.Condition(), vars)
+		if err != nil {
+			recorder.start(i, o, vars, "inprogress")
+			recorder.finish("error", nil, err)
+			opLogger.Errorf("---- Operation %s in %s has failed", o.String(), t.Name)
+			ch <- err
+			return
+		}
+		if !ok {
+			recorder.start(i, o, vars, "skipped")
+			recorder.finish("skipped", nil, nil)
+			opLogger.Infof("---- Operation %s has been skipped by condition(%s)", o.String(), o.Condition())
+			continue
+		}
+
+		opLogger.Infof("---- Operation %s has started", o.String())
+		recorder.start(i, o, vars, "inprogress")
+		started := time.Now()
+		output, err := o.Run(opLogger, vars)
+		if err != nil {
+			recorder.finish("error", output, err)
+			operationDuration.Observe(time.Since(started).Seconds(), o.Type(), "error")
+			opLogger.Errorf("---- Operation %s in %s has failed", o.String(), t.Name)
 			ch <- err
 			return
 		}
 
+		recorder.finish("success", output, nil)
+		operationDuration.Observe(time.Since(started).Seconds(), o.Type(), "success")
+
 		select {
 		case <-timeout:
 			return
 		default:
-			log.Infof("---- Operation %s has finished successfully", o.String())
+			opLogger.Infof("---- Operation %s has finished successfully", o.String())
 		}
 	}
 	ch <- nil
@@ -100,8 +213,10 @@ func (t *Task) String() string {
 	s += fmt.Sprintf("  Name: %s\n", t.Name)
 	s += fmt.Sprintf("  Pattern: %s\n", t.Pattern)
 	s += fmt.Sprintf("  Trigger: %s\n", t.Trigger)
+	s += fmt.Sprintf("  Debounce: %v\n", t.Debounce)
 	s += fmt.Sprintf("  Description: %s\n", t.Description)
 	s += fmt.Sprintf("  Timeout: %d\n", t.Timeout)
+	s += fmt.Sprintf("  When: %s\n", t.When)
 	s += fmt.Sprintf("  Filter: %v\n", t.Filter)
 
 	s += "  Operations:\n"
@@ -0,0 +1,144 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"metronome/util"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name       string
+		src        string
+		expected   []string
+		operations []string
+		err        error
+	}{
+		{"run", `{"name": "hello", "timeout": 5, "operations": [{"echo": "hello {{role}}"}, {"echo": "bye"}]}`, []string{
+			"-- Task hello has started",
+			"---- Operation echo has started",
+			"echo: hello web",
+			"echo: bye",
+			"-- Task hello has finished successfully",
+		}, []string{"echo:success", "echo:success"}, nil},
+		{"skip", `{"name": "hello", "timeout": 5, "when": "role == \"db\"", "operations": [{"echo": "hello"}]}`, []string{
+			"-- Task hello has been skipped by condition(role == \"db\")",
+		}, nil, ErrSkipped},
+	}
+
+	//	Log of task must be written only to logger of the task
+	var global bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&global)
+	defer log.SetOutput(out)
+
+	for _, c := range cases {
+		var task Task
+		if err := json.Unmarshal([]byte(c.src), &task); err != nil {
+			t.Fatalf("%s: Unmarshal() returns error: %s", c.name, err)
+		}
+
+		var b util.LogBuffer
+		l := log.New()
+		l.Out = &b
+		l.Formatter = &util.LogFormatter{}
+		results, err := task.Run(log.NewEntry(l), map[string]string{"role": "web"})
+		if err != c.err {
+			t.Errorf("%s: Run() returns %v, want %v", c.name, err, c.err)
+		}
+		var operations []string
+		for _, r := range results {
+			operations = append(operations, r.Type+":"+r.Status)
+		}
+		if !reflect.DeepEqual(operations, c.operations) {
+			t.Errorf("%s: Run() returns results %v, want %v", c.name, operations, c.operations)
+		}
+		for _, e := range c.expected {
+			if !strings.Contains(b.String(), e) {
+				t.Errorf("%s: log doesn't contain %q\n%s", c.name, e, b.String())
+			}
+		}
+	}
+	if global.Len() > 0 {
+		t.Errorf("Global logger has output of task\n%s", global.String())
+	}
+}
+
+func TestArguments(t *testing.T) {
+	task := &Task{
+		Name: "deploy",
+		Params: Params{
+			"version": Param{Required: true},
+			"env":     Param{Default: "production"},
+			"empty":   Param{Default: ""},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		with     map[string]string
+		expected map[string]string
+		err      bool
+	}{
+		{"defaults", map[string]string{"version": "1.0"}, map[string]string{"version": "1.0", "env": "production", "empty": ""}, false},
+		{"override default", map[string]string{"version": "1.0", "env": "staging"}, map[string]string{"version": "1.0", "env": "staging", "empty": ""}, false},
+		{"template is kept", map[string]string{"version": "{{version}}"}, map[string]string{"version": "{{version}}", "env": "production", "empty": ""}, false},
+		{"missing required", map[string]string{"env": "staging"}, nil, true},
+		{"nil with", nil, nil, true},
+		{"unknown param", map[string]string{"version": "1.0", "unknown": "x"}, nil, true},
+	}
+	for _, c := range cases {
+		actual, err := task.Arguments(c.with)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: Arguments() = %v, want error", c.name, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Arguments() returns error: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: Arguments() = %v, want %v", c.name, actual, c.expected)
+		}
+	}
+}
+
+func TestParamsUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected Params
+		err      bool
+	}{
+		{`{}`, Params{}, false},
+		{`{"a": null}`, Params{"a": Param{Required: true}}, false},
+		{`{"a": "x", "b": 1, "c": true}`, Params{"a": Param{Default: "x"}, "b": Param{Default: "1"}, "c": Param{Default: "true"}}, false},
+		{`{"a": ""}`, Params{"a": Param{Default: ""}}, false},
+		{`{"a": [1]}`, nil, true},
+		{`{"a": {"b": 1}}`, nil, true},
+		{`["a"]`, nil, true},
+	}
+	for _, c := range cases {
+		var actual Params
+		err := json.Unmarshal([]byte(c.src), &actual)
+		if c.err {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %v, want error", c.src, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s) returns error: %s", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", c.src, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"metronome/config"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/consul/api"
+)
+
+//	Function that can be called from conditional expression like key("path")
+type ExpressionFunction func(vars map[string]string, args []interface{}) (interface{}, error)
+
+var ExpressionFunctions map[string]ExpressionFunction
+
+func init() {
+	ExpressionFunctions = map[string]ExpressionFunction{
+		"key":         keyFunction,
+		"has_key":     hasKeyFunction,
+		"service":     serviceFunction,
+		"has_service": hasServiceFunction,
+	}
+}
+
+//	Evaluate conditional expression such as when attribute in task.yml
+//	Expression can refer variables, {{config.XXXX}} as config.XXXX, consul KVS and consul catalog
+//	ex. key("cloudconductor/replication") != "healthy" && has_service("postgresql", "standby")
+func Evaluate(expr string, vars map[string]string) (bool, error) {
+	if strings.TrimSpace(expr) == "" {
+		return true, nil
+	}
+
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return false, err
+	}
+
+	p := &expressionParser{tokens: tokens, vars: vars}
+	v, err := p.parseOr()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Failed to evaluate expression(%s)\n\t%s", expr, err))
+	}
+	if p.pos < len(p.tokens) {
+		return false, errors.New(fmt.Sprintf("Failed to evaluate expression(%s)\n\tUnexpected token %s", expr, p.tokens[p.pos].value))
+	}
+	return Truthy(v), nil
+}
+
+//	Return true when value is regarded as true in conditional expression
+func Truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "0" && strings.ToLower(v) != "false"
+	}
+	return false
+}
+
+const (
+	tokenIdent = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind  int
+	value string
+}
+
+var operators = []string{"==", "!=", "=~", "!~", "<=", ">=", "&&", "||", "|", "<", ">", "!", "(", ")", ","}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			//	Quoted string literal with backslash escape
+			var b []byte
+			j := i + 1
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b = append(b, s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.New(fmt.Sprintf("Unterminated string in expression(%s)", s))
+			}
+			tokens = append(tokens, token{tokenString, string(b)})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.' || s[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, s[i:j]})
+			i = j
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{tokenOperator, op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.New(fmt.Sprintf("Unexpected character %q in expression(%s)", c, s))
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type expressionParser struct {
+	tokens []token
+	pos    int
+	vars   map[string]string
+}
+
+func (p *expressionParser) peek(value string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOperator && p.tokens[p.pos].value == value
+}
+
+func (p *expressionParser) expect(value string) error {
+	if !p.peek(value) {
+		return errors.New(fmt.Sprintf("%s is expected", value))
+	}
+	p.pos++
+	return nil
+}
+
+func (p *expressionParser) parseOr() (interface{}, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("||") {
+		p.pos++
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = Truthy(l) || Truthy(r)
+	}
+	return l, nil
+}
+
+func (p *expressionParser) parseAnd() (interface{}, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("&&") {
+		p.pos++
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = Truthy(l) && Truthy(r)
+	}
+	return l, nil
+}
+
+func (p *expressionParser) parseNot() (interface{}, error) {
+	if p.peek("!") {
+		p.pos++
+		v, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return !Truthy(v), nil
+	}
+	return p.parseComparison()
+}
+
+func (p *expressionParser) parseComparison() (interface{}, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "=~", "!~", "<=", ">=", "<", ">"} {
+		if !p.peek(op) {
+			continue
+		}
+		p.pos++
+		r, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return compare(op, l, r)
+	}
+	return l, nil
+}
+
+func (p *expressionParser) parsePrimary() (interface{}, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("Unexpected end of expression")
+	}
+
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokenString:
+		return t.value, nil
+	case tokenNumber:
+		return strconv.ParseFloat(t.value, 64)
+	case tokenIdent:
+		if p.peek("(") {
+			return p.parseCall(t.value)
+		}
+		return p.resolve(t.value), nil
+	}
+
+	if t.value == "(" {
+		v, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return v, p.expect(")")
+	}
+	return nil, errors.New(fmt.Sprintf("Unexpected token %s", t.value))
+}
+
+func (p *expressionParser) parseCall(name string) (interface{}, error) {
+	f, ok := ExpressionFunctions[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Function %s is not defined", name))
+	}
+
+	var args []interface{}
+	p.pos++
+	for !p.peek(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		v, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	p.pos++
+	return f(p.vars, args)
+}
+
+//	Resolve identifier to boolean literal, configuration or variable
+func (p *expressionParser) resolve(name string) interface{} {
+	switch {
+	case name == "true":
+		return true
+	case name == "false":
+		return false
+	case strings.HasPrefix(name, "config."):
+		return config.GetValue(strings.TrimPrefix(name, "config."))
+	}
+
+	if v, ok := p.vars[name]; ok {
+		return unescapeLiteral(v)
+	}
+	return ""
+}
+
+func compare(op string, l interface{}, r interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return toString(l) == toString(r), nil
+	case "!=":
+		return toString(l) != toString(r), nil
+	case "=~", "!~":
+		re, err := regexp.Compile(toString(r))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(toString(l)) == (op == "=~"), nil
+	}
+
+	lf, err := strconv.ParseFloat(toString(l), 64)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%v is not a number", l))
+	}
+	rf, err := strconv.ParseFloat(toString(r), 64)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%v is not a number", r))
+	}
+	switch op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	default:
+		return lf >= rf, nil
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func stringArgs(name string, args []interface{}, min int, max int) ([]string, error) {
+	if len(args) < min || len(args) > max {
+		return nil, errors.New(fmt.Sprintf("Function %s has wrong number of arguments(%d)", name, len(args)))
+	}
+	var results []string
+	for _, a := range args {
+		results = append(results, toString(a))
+	}
+	return results, nil
+}
+
+//	key("path"): Return value in consul KVS or empty string when key doesn't exist
+func keyFunction(vars map[string]string, args []interface{}) (interface{}, error) {
+	a, err := stringArgs("key", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	kv, _, err := Consul().KV().Get(a[0], &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return "", nil
+	}
+	return string(kv.Value), nil
+}
+
+//	has_key("path"): Return true when key exists in consul KVS
+func hasKeyFunction(vars map[string]string, args []interface{}) (interface{}, error) {
+	a, err := stringArgs("has_key", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	kv, _, err := Consul().KV().Get(a[0], &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return kv != nil, nil
+}
+
+//	service("name", "tag"): Return number of instances in consul catalog
+func serviceFunction(vars map[string]string, args []interface{}) (interface{}, error) {
+	a, err := stringArgs("service", args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	tag := ""
+	if len(a) == 2 {
+		tag = a[1]
+	}
+	services, _, err := Consul().Catalog().Service(a[0], tag, &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return float64(len(services)), nil
+}
+
+//	has_service("name", "tag"): Return true when self node has service(and tag) in consul catalog
+func hasServiceFunction(vars map[string]string, args []interface{}) (interface{}, error) {
+	a, err := stringArgs("has_service", args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	tag := ""
+	if len(a) == 2 {
+		tag = a[1]
+	}
+
+	node := unescapeLiteral(vars["node"])
+	if node == "" {
+		if node, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	return HasCatalogRecord(node, a[0], tag), nil
+}
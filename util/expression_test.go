@@ -0,0 +1,81 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	vars := map[string]string{"role": "web", "count": "3", "empty": "", "flag": "false", "env": "production"}
+
+	cases := []struct {
+		expr     string
+		expected bool
+	}{
+		{``, true},
+		{`role == "web"`, true},
+		{`role != "web"`, false},
+		{`role == 'db' || role == "web"`, true},
+		{`role == "web" && count > 2`, true},
+		{`role == "web" && count > 3`, false},
+		{`!(count <= 3)`, false},
+		{`count >= 3.0`, true},
+		{`role =~ "^w"`, true},
+		{`role !~ "^w"`, false},
+		{`env == "production"`, true},
+		{`undefined == ""`, true},
+		{`empty`, false},
+		{`flag`, false},
+		{`count`, true},
+		{`true && !false`, true},
+	}
+	for _, c := range cases {
+		actual, err := Evaluate(c.expr, vars)
+		if err != nil {
+			t.Errorf("Evaluate(%q) returns error: %s", c.expr, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("Evaluate(%q) = %v, want %v", c.expr, actual, c.expected)
+		}
+	}
+}
+
+func TestEvaluateError(t *testing.T) {
+	cases := []string{
+		`role ==`,
+		`(role == "web"`,
+		`role == "web" extra`,
+		`"unterminated`,
+		`role # "web"`,
+		`count > "x"`,
+		`undefined_function("x")`,
+		`role =~ "("`,
+	}
+	for _, expr := range cases {
+		if _, err := Evaluate(expr, map[string]string{"role": "web", "count": "3"}); err == nil {
+			t.Errorf("Evaluate(%q) doesn't return error", expr)
+		}
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected bool
+	}{
+		{true, true},
+		{false, false},
+		{float64(0), false},
+		{float64(1), true},
+		{"", false},
+		{"0", false},
+		{"FALSE", false},
+		{"yes", true},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if actual := Truthy(c.value); actual != c.expected {
+			t.Errorf("Truthy(%#v) = %v, want %v", c.value, actual, c.expected)
+		}
+	}
+}
@@ -1,23 +1,87 @@
 package util
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/syslog"
+	"sort"
 	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 )
 
+//	ExcludeFields hides fields that are obvious from context such as task log
 type LogFormatter struct {
+	ExcludeFields []string
 }
 
-//	Set time format and level in log format
+//	Set time format and level in log format, and append fields as key=value
 func (f *LogFormatter) Format(entry *log.Entry) ([]byte, error) {
 	time := entry.Time.Format("2006-01-02T15:04:05.000Z07:00")
-	level := strings.ToUpper(entry.Level.String())
+	var fields []string
+	for _, k := range sortedFieldKeys(entry.Data) {
+		if contains(f.ExcludeFields, k) {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf(" %s=%v", k, entry.Data[k]))
+	}
+	return []byte(fmt.Sprintf("%s [%-5s] %s%s\n", time, levelString(entry.Level), entry.Message, strings.Join(fields, ""))), nil
+}
+
+type JSONFormatter struct {
+}
+
+//	Output time, level, message and all fields as one JSON object per line
+//	Fields that have same name as time, level or message are prefixed by fields. to keep them
+func (f *JSONFormatter) Format(entry *log.Entry) ([]byte, error) {
+	data := make(map[string]interface{})
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		if k == "time" || k == "level" || k == "message" {
+			k = "fields." + k
+		}
+		data[k] = v
+	}
+	data["time"] = entry.Time.Format("2006-01-02T15:04:05.000Z07:00")
+	data["level"] = levelString(entry.Level)
+	data["message"] = entry.Message
+
+	d, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(d, '\n'), nil
+}
+
+func levelString(l log.Level) string {
+	level := strings.ToUpper(l.String())
 	if level == "WARNING" {
 		level = "WARN"
 	}
-	return []byte(fmt.Sprintf("%s [%-5s] %s\n", time, level, entry.Message)), nil
+	return level
+}
+
+func sortedFieldKeys(data log.Fields) []string {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
 }
 
 type SimpleFormatter struct {
@@ -27,3 +91,94 @@ type SimpleFormatter struct {
 func (f *SimpleFormatter) Format(entry *log.Entry) ([]byte, error) {
 	return []byte(entry.Message), nil
 }
+
+//	Create logger that has same output, format, level and hooks as global logger
+func NewLogger() *log.Logger {
+	std := log.StandardLogger()
+	l := log.New()
+	l.Out = std.Out
+	l.Formatter = std.Formatter
+	l.Level = log.GetLevel()
+	for _, hooks := range std.Hooks {
+		for _, h := range hooks {
+			l.Hooks.Add(h)
+		}
+	}
+	return l
+}
+
+//	Hook that writes entries to writer with its own formatter in addition to output of logger
+type WriterHook struct {
+	Writer    io.Writer
+	Formatter log.Formatter
+}
+
+func (h *WriterHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel, log.InfoLevel, log.DebugLevel}
+}
+
+func (h *WriterHook) Fire(entry *log.Entry) error {
+	d, err := h.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.Writer.Write(d)
+	return err
+}
+
+//	Hook that sends entries to local syslog via unix socket
+type SyslogHook struct {
+	Writer    *syslog.Writer
+	Formatter log.Formatter
+}
+
+func NewSyslogHook(tag string, formatter log.Formatter) (*SyslogHook, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogHook{Writer: w, Formatter: formatter}, nil
+}
+
+func (h *SyslogHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel, log.InfoLevel, log.DebugLevel}
+}
+
+func (h *SyslogHook) Fire(entry *log.Entry) error {
+	d, err := h.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(string(d), "\n")
+
+	switch entry.Level {
+	case log.PanicLevel, log.FatalLevel:
+		return h.Writer.Crit(line)
+	case log.ErrorLevel:
+		return h.Writer.Err(line)
+	case log.WarnLevel:
+		return h.Writer.Warning(line)
+	case log.InfoLevel:
+		return h.Writer.Info(line)
+	default:
+		return h.Writer.Debug(line)
+	}
+}
+
+//	Buffer that captures log of a task and can be read while the task is writing
+type LogBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *LogBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
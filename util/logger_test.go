@@ -0,0 +1,48 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	entry := log.NewEntry(log.New()).WithFields(log.Fields{
+		"event":   "deploy",
+		"error":   errors.New("failed"),
+		"time":    "field-time",
+		"level":   "field-level",
+		"message": "field-message",
+	})
+	entry.Time = time.Date(2016, 1, 31, 12, 0, 0, 0, time.UTC)
+	entry.Level = log.WarnLevel
+	entry.Message = "hello"
+
+	d, err := (&JSONFormatter{}).Format(entry)
+	if err != nil {
+		t.Fatalf("Format() returns error: %s", err)
+	}
+	var actual map[string]string
+	if err := json.Unmarshal(d, &actual); err != nil {
+		t.Fatalf("Format() returns invalid JSON %s(%s)", d, err)
+	}
+
+	//	Fields don't overwrite time, level and message of entry
+	expected := map[string]string{
+		"time":           "2016-01-31T12:00:00.000Z",
+		"level":          "WARN",
+		"message":        "hello",
+		"event":          "deploy",
+		"error":          "failed",
+		"fields.time":    "field-time",
+		"fields.level":   "field-level",
+		"fields.message": "field-message",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Format() = %v, want %v", actual, expected)
+	}
+}
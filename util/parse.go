@@ -1,67 +1,119 @@
 package util
 
 import (
-	"metronome/config"
-	"regexp"
-
-	"github.com/imdario/mergo"
+	log "github.com/Sirupsen/logrus"
 )
 
 //	Parse {{XXXX}} to value by appropriate method depending on type of src
+//	Value is returned as it is when template can't be rendered, use RenderValue to handle error
 func Parse(src interface{}, vars map[string]string) interface{} {
-	switch src := src.(type) {
-	default:
+	result, err := RenderValue(src, vars)
+	if err != nil {
+		log.Warnf("Failed to render template(%s)", err)
 		return src
-	case string:
-		return ParseString(src, vars)
-	case []string:
-		return ParseArray(src, vars)
-	case map[string]interface{}:
-		return ParseMap(src, vars)
 	}
+	return result
 }
 
 //	Parse {{XXXX}} in string to value
+//	Source is returned as it is even in strict mode, so use it only to describe values and use Render to run them
 func ParseString(src string, vars map[string]string) string {
-	mergo.Merge(&vars, map[string]string(config.UserVariables))
-
-	r := regexp.MustCompile("{{([^{}]+)}}")
-	for prev := ""; prev != src; {
-		prev = src
-		src = r.ReplaceAllStringFunc(src, func(s string) string {
-			r2 := regexp.MustCompile(`{{config\.([^{}]+)}}`)
-			matches := r2.FindStringSubmatch(s)
-			if len(matches) == 2 {
-				return config.GetValue(matches[1])
-			} else {
-				k := s[2 : len(s)-2]
-				v, ok := vars[k]
-				if !ok {
-					return s
-				}
-				return v
-			}
-		})
+	result, err := Render(src, vars)
+	if err != nil {
+		log.Warnf("Failed to render template(%s)", err)
+		return src
 	}
-
-	return src
+	return result
 }
 
 //	Parse {{XXXX}} in array of string to value
 func ParseArray(src []string, vars map[string]string) []string {
-	var results []string
-	for _, e := range src {
-		results = append(results, ParseString(e, vars))
+	results, err := RenderArray(src, vars)
+	if err != nil {
+		log.Warnf("Failed to render template(%s)", err)
+		return src
 	}
 	return results
 }
 
 //	Parse {{XXXX}} in map to value
 func ParseMap(src map[string]interface{}, vars map[string]string) map[string]interface{} {
-	results := make(map[string]interface{})
+	results, err := RenderMap(src, vars)
+	if err != nil {
+		log.Warnf("Failed to render template(%s)", err)
+		return src
+	}
+	return results
+}
 
+//	Render templates in src by appropriate method depending on type of src
+//	It recurses into arrays and nested maps, keys of map aren't rendered
+func RenderValue(src interface{}, vars map[string]string) (interface{}, error) {
+	switch src := src.(type) {
+	default:
+		return src, nil
+	case string:
+		return Render(src, vars)
+	case []string:
+		return RenderArray(src, vars)
+	case []interface{}:
+		//	Empty list must be kept as empty list, nil is encoded as null in JSON
+		results := make([]interface{}, 0, len(src))
+		for _, e := range src {
+			v, err := RenderValue(e, vars)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, v)
+		}
+		return results, nil
+	case map[string]interface{}:
+		return RenderMap(src, vars)
+	case map[string]string:
+		results := make(map[string]string)
+		for k, v := range src {
+			s, err := Render(v, vars)
+			if err != nil {
+				return nil, err
+			}
+			results[k] = s
+		}
+		return results, nil
+	case map[interface{}]interface{}:
+		results := make(map[interface{}]interface{})
+		for k, v := range src {
+			e, err := RenderValue(v, vars)
+			if err != nil {
+				return nil, err
+			}
+			results[k] = e
+		}
+		return results, nil
+	}
+}
+
+//	Render templates in array of string
+func RenderArray(src []string, vars map[string]string) ([]string, error) {
+	var results []string
+	for _, e := range src {
+		s, err := Render(e, vars)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, nil
+}
+
+//	Render templates in values of map
+func RenderMap(src map[string]interface{}, vars map[string]string) (map[string]interface{}, error) {
+	results := make(map[string]interface{})
 	for k, v := range src {
-		results[k] = Parse(v, vars)
+		e, err := RenderValue(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		results[k] = e
 	}
-	return results
+	return results, nil
 }
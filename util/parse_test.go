@@ -0,0 +1,36 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderValue(t *testing.T) {
+	vars := map[string]string{"name": "web", "port": "80"}
+	cases := []struct {
+		src      interface{}
+		expected string
+	}{
+		{"{{name}}", `"web"`},
+		{float64(1), `1`},
+		{true, `true`},
+		{nil, `null`},
+		{[]interface{}{}, `[]`},
+		{[]interface{}{"{{name}}", float64(2)}, `["web",2]`},
+		{[]string{"{{name}}", "{{port}}"}, `["web","80"]`},
+		{map[string]interface{}{"name": "{{name}}", "tags": []interface{}{}}, `{"name":"web","tags":[]}`},
+		{map[string]interface{}{"nested": map[string]interface{}{"port": "{{port}}"}}, `{"nested":{"port":"80"}}`},
+		{map[string]string{"{{name}}": "{{port}}"}, `{"{{name}}":"80"}`},
+	}
+	for _, c := range cases {
+		v, err := RenderValue(c.src, vars)
+		if err != nil {
+			t.Errorf("RenderValue(%#v) returns error: %s", c.src, err)
+			continue
+		}
+		actual, _ := json.Marshal(v)
+		if string(actual) != c.expected {
+			t.Errorf("RenderValue(%#v) = %s, want %s", c.src, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//	File that is rotated when it exceeds MaxSize bytes or has been opened longer than MaxAge
+//	Rotated files are renamed with timestamp suffix and only latest Backups files are kept
+type RotatingFile struct {
+	Path    string
+	MaxSize int64
+	MaxAge  time.Duration
+	Backups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, backups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		Path:    path,
+		MaxSize: maxSize,
+		MaxAge:  maxAge,
+		Backups: backups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rotateErr error
+	if f.size > 0 && (f.MaxSize > 0 && f.size+int64(len(p)) > f.MaxSize || f.MaxAge > 0 && time.Since(f.openedAt) > f.MaxAge) {
+		//	Write to current file even if rotation has failed, otherwise log will be lost
+		rotateErr = f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil && rotateErr != nil {
+		err = errors.New(fmt.Sprintf("Failed to rotate %s(%s)", f.Path, rotateErr))
+	}
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	//	Age of existing file is counted from its last modification because its creation time isn't available
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = info.ModTime()
+	return nil
+}
+
+//	Rename current file with timestamp and delete old files over backups
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	//	Continue to write current file when it can't be renamed
+	//	Suffix has nanoseconds to keep backups that are rotated in same second from overwriting each other
+	renameErr := os.Rename(f.Path, f.Path+"."+time.Now().Format("20060102-150405.000000000"))
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	backups, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for i := 0; i < len(backups)-f.Backups; i++ {
+		os.Remove(backups[i])
+	}
+	return nil
+}
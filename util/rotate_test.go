@@ -0,0 +1,121 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	cases := []struct {
+		name            string
+		maxSize         int64
+		backups         int
+		writes          []string
+		expectedCurrent string
+		expectedBackups int
+	}{
+		{"no rotation", 0, 2, []string{"a\n", "b\n", "c\n"}, "a\nb\nc\n", 0},
+		{"rotate by size", 4, 5, []string{"a\n", "b\n", "c\n"}, "c\n", 1},
+		{"rotate in same second", 2, 5, []string{"a\n", "b\n", "c\n", "d\n"}, "d\n", 3},
+		{"delete old backups", 2, 2, []string{"a\n", "b\n", "c\n", "d\n", "e\n"}, "e\n", 2},
+		{"large write", 2, 5, []string{"abcdef\n", "g\n"}, "g\n", 1},
+	}
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "metronome")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "agent.log")
+		f, err := NewRotatingFile(path, c.maxSize, 0, c.backups)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range c.writes {
+			if _, err := f.Write([]byte(w)); err != nil {
+				t.Errorf("%s: Write returns error: %s", c.name, err)
+			}
+		}
+		f.Close()
+
+		current, _ := ioutil.ReadFile(path)
+		if string(current) != c.expectedCurrent {
+			t.Errorf("%s: current file has %q, want %q", c.name, current, c.expectedCurrent)
+		}
+		backups, _ := filepath.Glob(path + ".*")
+		if len(backups) != c.expectedBackups {
+			t.Errorf("%s: %d backups are kept, want %d", c.name, len(backups), c.expectedBackups)
+		}
+
+		//	Latest backups must be kept in order of rotation
+		var contents []string
+		for _, b := range backups {
+			d, _ := ioutil.ReadFile(b)
+			contents = append(contents, string(d))
+		}
+		all := strings.Join(append(contents, string(current)), "")
+		if !strings.HasSuffix(strings.Join(c.writes, ""), all) {
+			t.Errorf("%s: files have %q, want suffix of writes", c.name, all)
+		}
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metronome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//	Existing file that has been written long ago is rotated by first write after restart
+	old := filepath.Join(dir, "old.log")
+	ioutil.WriteFile(old, []byte("a\n"), 0644)
+	os.Chtimes(old, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour))
+	recent := filepath.Join(dir, "recent.log")
+	ioutil.WriteFile(recent, []byte("a\n"), 0644)
+
+	for path, expected := range map[string]int{old: 1, recent: 0} {
+		f, err := NewRotatingFile(path, 0, time.Hour, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("b\n")); err != nil {
+			t.Errorf("%s: Write returns error: %s", path, err)
+		}
+		f.Close()
+		if backups, _ := filepath.Glob(path + ".*"); len(backups) != expected {
+			t.Errorf("%s: %d backups are made, want %d", path, len(backups), expected)
+		}
+	}
+}
+
+func TestRotatingFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metronome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "agent.log")
+	f, err := NewRotatingFile(path, 2, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("a\n"))
+
+	//	File that has been removed by others can't be renamed, but log is written to new file
+	os.Remove(path)
+	n, err := f.Write([]byte("b\n"))
+	if err == nil || n != 2 {
+		t.Errorf("Write returns (%d, %v), want rotation error after writing 2 bytes", n, err)
+	}
+	if current, _ := ioutil.ReadFile(path); string(current) != "b\n" {
+		t.Errorf("current file has %q, want %q", current, "b\n")
+	}
+}
@@ -0,0 +1,675 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metronome/config"
+	"strconv"
+	"strings"
+)
+
+//	Template in task.yml is text with actions in {{ }}
+//	{{var}}, {{config.XXXX}}              Value of variable or configuration
+//	{{key "path"}}                        Result of function
+//	{{var | default "x" | upper}}         Value converted by filters
+//	{{if expr}} ... {{else}} ... {{end}}  Conditional that is evaluated same as when attribute
+//	\{{                                   Literal {{
+//	Value of variable is rendered as template too, and variable that refers itself causes error
+//	Values that come from outside of task.yml and variables.yml are escaped by Literal to keep them from being rendered
+type templateNode interface{}
+
+type textNode string
+
+//	{{term | filter arg ...}}, term is variable, string or function call with arguments
+type actionNode struct {
+	source  string
+	term    token
+	args    []token
+	filters []filterCall
+	err     error
+}
+
+type filterCall struct {
+	name string
+	args []token
+}
+
+type ifNode struct {
+	conditions []string
+	bodies     [][]templateNode
+	elseBody   []templateNode
+}
+
+//	Action that isn't valid syntax like {{foo bar}}
+type ActionError struct {
+	Action string
+	Reason error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("{{%s}} is invalid(%s)", strings.TrimSpace(e.Action), e.Reason)
+}
+
+type templateItem struct {
+	text   string
+	action bool
+}
+
+//	Function that can be called in template like {{key "path"}}
+//	Value other than string is rendered as JSON, and nil means undefined
+type templateFunction struct {
+	min  int
+	max  int
+	call func(vars map[string]string, args []string) (interface{}, error)
+}
+
+var templateFunctions map[string]templateFunction
+
+//	Filter converts value of pipeline, nil value means undefined
+type templateFilter struct {
+	args  int
+	apply func(v interface{}, args []string) (interface{}, error)
+}
+
+var templateFilters map[string]templateFilter
+
+func init() {
+	templateFilters = map[string]templateFilter{
+		"default":  {1, defaultFilter},
+		"upper":    {0, stringFilter(strings.ToUpper)},
+		"lower":    {0, stringFilter(strings.ToLower)},
+		"trim":     {0, stringFilter(strings.TrimSpace)},
+		"replace":  {2, replaceFilter},
+		"quote":    {0, stringFilter(shellQuote)},
+		"json":     {0, jsonFilter},
+		"jsonpath": {1, jsonPathFilter},
+	}
+}
+
+//	Render template with variables, vars must contain user variables in variables.yml and -var
+//	Undefined variable is left as it is, or causes error when -strict-variables is specified
+func Render(src string, vars map[string]string) (string, error) {
+	if !strings.Contains(src, "{{") {
+		return src, nil
+	}
+	nodes, err := parseTemplate(src)
+	if err != nil {
+		return "", err
+	}
+
+	r := &templateRenderer{vars: vars, strict: config.StrictVariables}
+	var buf bytes.Buffer
+	if err := r.render(nodes, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//	Render template same as Render, but results of actions are converted by escape
+//	Text outside of actions is kept as it is, to embed values in JSON or other structured text safely
+func RenderEscaped(src string, vars map[string]string, escape func(string) string) (string, error) {
+	if !strings.Contains(src, "{{") {
+		return src, nil
+	}
+	nodes, err := parseTemplate(src)
+	if err != nil {
+		return "", err
+	}
+
+	r := &templateRenderer{vars: vars, strict: config.StrictVariables, escape: escape}
+	var buf bytes.Buffer
+	if err := r.render(nodes, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//	Return variables that must be defined to render template
+//	Variables in conditions and variables with default filter are excluded because they may be undefined
+func TemplateVariables(src string) ([]string, error) {
+	if !strings.Contains(src, "{{") {
+		return nil, nil
+	}
+	nodes, err := parseTemplate(src)
+	if err != nil {
+		return nil, err
+	}
+	return templateVariables(nodes)
+}
+
+func templateVariables(nodes []templateNode) ([]string, error) {
+	var results []string
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *actionNode:
+			if n.err != nil {
+				return nil, &ActionError{Action: n.source, Reason: n.err}
+			}
+			optional := false
+			for _, f := range n.filters {
+				if f.name == "default" {
+					optional = true
+					continue
+				}
+				for _, a := range f.args {
+					if a.kind == tokenIdent && !strings.HasPrefix(a.value, "config.") {
+						results = append(results, a.value)
+					}
+				}
+			}
+			for _, a := range n.args {
+				if a.kind == tokenIdent && !strings.HasPrefix(a.value, "config.") {
+					results = append(results, a.value)
+				}
+			}
+			if _, ok := templateFunctions[n.term.value]; ok {
+				continue
+			}
+			if n.term.kind == tokenIdent && !optional && !strings.HasPrefix(n.term.value, "config.") {
+				results = append(results, n.term.value)
+			}
+		case *ifNode:
+			for _, body := range append(n.bodies, n.elseBody) {
+				vars, err := templateVariables(body)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, vars...)
+			}
+		}
+	}
+	return results, nil
+}
+
+//	Escape {{ in value of variable that must not be rendered as template, such as event parameters
+//	Rendered template has the value as it is because \{{ is unescaped to {{
+func Literal(s string) string {
+	return strings.Replace(s, "{{", `\{{`, -1)
+}
+
+//	Reverse Literal for value that is used without rendering
+func unescapeLiteral(s string) string {
+	return strings.Replace(s, `\{{`, "{{", -1)
+}
+
+//	Split template to texts and actions, \{{ is unescaped to text
+func lexTemplate(src string) []templateItem {
+	var items []templateItem
+	var buf bytes.Buffer
+	for i := 0; i < len(src); {
+		if strings.HasPrefix(src[i:], `\{{`) {
+			buf.WriteString("{{")
+			i += 3
+			continue
+		}
+		if strings.HasPrefix(src[i:], "{{") {
+			if end := closingBraces(src, i+2); end >= 0 {
+				if buf.Len() > 0 {
+					items = append(items, templateItem{text: buf.String()})
+					buf.Reset()
+				}
+				items = append(items, templateItem{text: src[i+2 : end], action: true})
+				i = end + 2
+				continue
+			}
+		}
+		buf.WriteByte(src[i])
+		i++
+	}
+	if buf.Len() > 0 {
+		items = append(items, templateItem{text: buf.String()})
+	}
+	return items
+}
+
+//	Return index of }} that closes action, or -1 when braces appear before it like {{{var}}}
+func closingBraces(src string, start int) int {
+	var quote byte
+	for i := start; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(src[i:], "}}"):
+			return i
+		case c == '{' || c == '}':
+			return -1
+		}
+	}
+	return -1
+}
+
+type templateParser struct {
+	items []templateItem
+	pos   int
+}
+
+func parseTemplate(src string) ([]templateNode, error) {
+	p := &templateParser{items: lexTemplate(src)}
+	nodes, stop, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if stop != "" {
+		return nil, errors.New(fmt.Sprintf("{{%s}} doesn't have corresponding {{if}}", stop))
+	}
+	return nodes, nil
+}
+
+//	Parse nodes until {{else}} or {{end}}, and return it as stop
+func (p *templateParser) parseList() ([]templateNode, string, error) {
+	var nodes []templateNode
+	for p.pos < len(p.items) {
+		item := p.items[p.pos]
+		p.pos++
+		if !item.action {
+			nodes = append(nodes, textNode(item.text))
+			continue
+		}
+
+		content := strings.TrimSpace(item.text)
+		switch keyword, rest := splitKeyword(content); keyword {
+		case "if":
+			n, err := p.parseIf(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+		case "else", "end":
+			return nodes, content, nil
+		default:
+			nodes = append(nodes, parseAction(item.text))
+		}
+	}
+	return nodes, "", nil
+}
+
+func (p *templateParser) parseIf(condition string) (*ifNode, error) {
+	n := &ifNode{}
+	for {
+		if condition == "" {
+			return nil, errors.New("{{if}} requires condition")
+		}
+		body, stop, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		n.conditions = append(n.conditions, condition)
+		n.bodies = append(n.bodies, body)
+
+		keyword, rest := splitKeyword(stop)
+		switch {
+		case stop == "":
+			return nil, errors.New(fmt.Sprintf("{{if %s}} isn't closed by {{end}}", condition))
+		case stop == "end":
+			return n, nil
+		case keyword == "else" && rest == "":
+			body, stop, err := p.parseList()
+			if err != nil {
+				return nil, err
+			}
+			if stop != "end" {
+				return nil, errors.New(fmt.Sprintf("{{else}} of {{if %s}} isn't closed by {{end}}", condition))
+			}
+			n.elseBody = body
+			return n, nil
+		case keyword == "else":
+			if keyword, rest = splitKeyword(rest); keyword != "if" {
+				return nil, errors.New(fmt.Sprintf("Unexpected {{%s}}", stop))
+			}
+			condition = rest
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected {{%s}}", stop))
+		}
+	}
+}
+
+func splitKeyword(content string) (string, string) {
+	fields := strings.SplitN(content, " ", 2)
+	switch fields[0] {
+	case "if", "else", "end":
+		if len(fields) == 1 {
+			return fields[0], ""
+		}
+		return fields[0], strings.TrimSpace(fields[1])
+	}
+	return "", content
+}
+
+//	Parse pipeline in action, error is kept in node because invalid action is left as it is unless strict mode
+func parseAction(source string) *actionNode {
+	n := &actionNode{source: source}
+	tokens, err := tokenize(source)
+	if err != nil {
+		n.err = err
+		return n
+	}
+	if len(tokens) == 0 || tokens[0].kind == tokenOperator {
+		n.err = errors.New("variable or string is expected")
+		return n
+	}
+	n.term = tokens[0]
+
+	i := 1
+	for ; i < len(tokens) && tokens[i].kind != tokenOperator; i++ {
+		n.args = append(n.args, tokens[i])
+	}
+	if len(n.args) > 0 {
+		f, ok := templateFunctions[n.term.value]
+		if !ok || n.term.kind != tokenIdent {
+			n.err = errors.New(fmt.Sprintf("Function %s is not defined", n.term.value))
+			return n
+		}
+		if len(n.args) < f.min || len(n.args) > f.max {
+			n.err = errors.New(fmt.Sprintf("Function %s has wrong number of arguments(%d)", n.term.value, len(n.args)))
+			return n
+		}
+	}
+
+	for i < len(tokens) {
+		if tokens[i].kind != tokenOperator || tokens[i].value != "|" {
+			n.err = errors.New(fmt.Sprintf("Unexpected token %s", tokens[i].value))
+			return n
+		}
+		if i+1 >= len(tokens) || tokens[i+1].kind != tokenIdent {
+			n.err = errors.New("filter is expected after |")
+			return n
+		}
+		f := filterCall{name: tokens[i+1].value}
+		for i += 2; i < len(tokens) && tokens[i].kind != tokenOperator; i++ {
+			f.args = append(f.args, tokens[i])
+		}
+
+		filter, ok := templateFilters[f.name]
+		if !ok {
+			n.err = errors.New(fmt.Sprintf("Filter %s is not defined", f.name))
+			return n
+		}
+		if len(f.args) != filter.args {
+			n.err = errors.New(fmt.Sprintf("Filter %s has wrong number of arguments(%d)", f.name, len(f.args)))
+			return n
+		}
+		n.filters = append(n.filters, f)
+	}
+	return n
+}
+
+type templateRenderer struct {
+	vars   map[string]string
+	strict bool
+
+	//	Escape results of actions in top level template, nil doesn't escape them
+	escape func(string) string
+
+	//	Variables that are being rendered to detect circular reference
+	stack []string
+}
+
+func (r *templateRenderer) render(nodes []templateNode, buf *bytes.Buffer) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			buf.WriteString(string(n))
+		case *actionNode:
+			v, err := r.action(n)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				if r.strict {
+					return errors.New(fmt.Sprintf("{{%s}} refers undefined variable", strings.TrimSpace(n.source)))
+				}
+				buf.WriteString(r.escaped("{{" + n.source + "}}"))
+				continue
+			}
+			buf.WriteString(r.escaped(templateString(v)))
+		case *ifNode:
+			body := n.elseBody
+			for i, c := range n.conditions {
+				ok, err := r.condition(c)
+				if err != nil {
+					return err
+				}
+				if ok {
+					body = n.bodies[i]
+					break
+				}
+			}
+			if err := r.render(body, buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *templateRenderer) escaped(s string) string {
+	if r.escape == nil {
+		return s
+	}
+	return r.escape(s)
+}
+
+//	Evaluate pipeline in action, it returns nil when value is undefined
+func (r *templateRenderer) action(n *actionNode) (interface{}, error) {
+	if n.err != nil {
+		//	Compatible with variable whose name isn't valid identifier
+		if v, err := r.variable(n.source); v != nil || err != nil {
+			return v, err
+		}
+		if r.strict {
+			return nil, &ActionError{Action: n.source, Reason: n.err}
+		}
+		return nil, nil
+	}
+
+	v, err := r.term(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range n.filters {
+		if v == nil && f.name != "default" {
+			return nil, nil
+		}
+		args, err := r.arguments(f.args)
+		if err != nil || args == nil && len(f.args) > 0 {
+			return nil, err
+		}
+		if v, err = templateFilters[f.name].apply(v, args); err != nil {
+			return nil, errors.New(fmt.Sprintf("{{%s}} has failed in filter %s(%s)", strings.TrimSpace(n.source), f.name, err))
+		}
+	}
+	return v, nil
+}
+
+//	Variable takes precedence over function without arguments to keep {{node}} as variable in tasks
+func (r *templateRenderer) term(n *actionNode) (interface{}, error) {
+	f, ok := templateFunctions[n.term.value]
+	if len(n.args) == 0 {
+		v, err := r.operand(n.term)
+		if v != nil || err != nil || !ok || f.min > 0 || n.term.kind != tokenIdent {
+			return v, err
+		}
+	}
+
+	args, err := r.arguments(n.args)
+	if err != nil || args == nil && len(n.args) > 0 {
+		return nil, err
+	}
+	v, err := f.call(r.vars, args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("{{%s}} has failed(%s)", strings.TrimSpace(n.source), err))
+	}
+	return v, nil
+}
+
+//	Return values of arguments, or nil when any of them is undefined
+func (r *templateRenderer) arguments(tokens []token) ([]string, error) {
+	var args []string
+	for _, t := range tokens {
+		v, err := r.operand(t)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		args = append(args, templateString(v))
+	}
+	return args, nil
+}
+
+func (r *templateRenderer) operand(t token) (interface{}, error) {
+	if t.kind == tokenIdent {
+		return r.variable(t.value)
+	}
+	return t.value, nil
+}
+
+//	Return rendered value of variable, or nil when it isn't defined
+func (r *templateRenderer) variable(name string) (interface{}, error) {
+	if strings.HasPrefix(name, "config.") {
+		return config.GetValue(strings.TrimPrefix(name, "config.")), nil
+	}
+
+	v, ok := r.vars[name]
+	if !ok {
+		return nil, nil
+	}
+
+	for i, s := range r.stack {
+		if s == name {
+			return nil, errors.New(fmt.Sprintf("Variable %s refers itself(%s)", name, strings.Join(append(r.stack[i:], name), " -> ")))
+		}
+	}
+	if !strings.Contains(v, "{{") {
+		return v, nil
+	}
+
+	nodes, err := parseTemplate(v)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Variable %s is invalid template(%s)", name, err))
+	}
+	//	Value of variable is escaped as a whole by caller
+	escape := r.escape
+	r.escape = nil
+	r.stack = append(r.stack, name)
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+		r.escape = escape
+	}()
+
+	var buf bytes.Buffer
+	if err := r.render(nodes, &buf); err != nil {
+		return nil, err
+	}
+	return buf.String(), nil
+}
+
+//	Evaluate condition with rendered variables, undefined variable is regarded as empty string even in strict mode
+func (r *templateRenderer) condition(expr string) (bool, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return false, err
+	}
+
+	vars := make(map[string]string)
+	for i, t := range tokens {
+		if t.kind != tokenIdent || t.value == "true" || t.value == "false" || strings.HasPrefix(t.value, "config.") {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].kind == tokenOperator && tokens[i+1].value == "(" {
+			continue
+		}
+		v, err := r.variable(t.value)
+		if err != nil {
+			return false, err
+		}
+		if v != nil {
+			vars[t.value] = templateString(v)
+		}
+	}
+	return Evaluate(expr, vars)
+}
+
+//	Convert value to string in rendered text, value other than string is encoded as JSON
+func templateString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	d, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(d)
+}
+
+func stringFilter(f func(string) string) func(interface{}, []string) (interface{}, error) {
+	return func(v interface{}, args []string) (interface{}, error) {
+		return f(templateString(v)), nil
+	}
+}
+
+//	default "x": Use x when value is undefined or empty
+func defaultFilter(v interface{}, args []string) (interface{}, error) {
+	if templateString(v) == "" {
+		return args[0], nil
+	}
+	return v, nil
+}
+
+//	replace "old" "new": Replace all old in value with new
+func replaceFilter(v interface{}, args []string) (interface{}, error) {
+	return strings.Replace(templateString(v), args[0], args[1], -1), nil
+}
+
+//	quote: Quote value with single quotation to use it as an argument in shell script
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+//	json: Encode value as JSON, string value becomes JSON string
+func jsonFilter(v interface{}, args []string) (interface{}, error) {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(d), nil
+}
+
+//	jsonpath "a.b.0": Extract element from JSON value by keys and indexes separated by dot
+//	Element that doesn't exist is regarded as undefined
+func jsonPathFilter(v interface{}, args []string) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, errors.New(fmt.Sprintf("value isn't JSON(%s)", err))
+		}
+	}
+
+	for _, key := range strings.Split(args[0], ".") {
+		if key == "" {
+			continue
+		}
+		switch e := v.(type) {
+		case map[string]interface{}:
+			v = e[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(e) {
+				return nil, nil
+			}
+			v = e[i]
+		default:
+			return nil, nil
+		}
+	}
+	return v, nil
+}
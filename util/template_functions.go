@@ -0,0 +1,163 @@
+package util
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func init() {
+	templateFunctions = map[string]templateFunction{
+		"service":      {1, 2, serviceTemplateFunction},
+		"services":     {0, 0, servicesTemplateFunction},
+		"key":          {1, 1, keyTemplateFunction},
+		"keyOrDefault": {2, 2, keyOrDefaultTemplateFunction},
+		"ls":           {1, 1, lsTemplateFunction},
+		"node":         {0, 1, nodeTemplateFunction},
+	}
+}
+
+//	Convert strings to JSON compatible value to access them by jsonpath filter
+func stringsValue(src []string) []interface{} {
+	results := make([]interface{}, 0)
+	for _, s := range src {
+		results = append(results, s)
+	}
+	return results
+}
+
+//	service "name" "tag": Return instances of service that pass health checks
+//	ex. [{"id": "postgresql", "node": "db1", "address": "10.0.0.1", "port": 5432, "tags": ["primary"]}]
+func serviceTemplateFunction(vars map[string]string, args []string) (interface{}, error) {
+	tag := ""
+	if len(args) == 2 {
+		tag = args[1]
+	}
+	entries, _, err := Consul().Health().Service(args[0], tag, true, &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]interface{}, 0)
+	for _, e := range entries {
+		address := e.Service.Address
+		if address == "" {
+			address = e.Node.Address
+		}
+		results = append(results, map[string]interface{}{
+			"id":      e.Service.ID,
+			"node":    e.Node.Node,
+			"address": address,
+			"port":    float64(e.Service.Port),
+			"tags":    stringsValue(e.Service.Tags),
+		})
+	}
+	return results, nil
+}
+
+//	services: Return all services and their tags in consul catalog
+//	ex. {"consul": [], "postgresql": ["primary", "standby"]}
+func servicesTemplateFunction(vars map[string]string, args []string) (interface{}, error) {
+	services, _, err := Consul().Catalog().Services(&api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]interface{})
+	for name, tags := range services {
+		results[name] = stringsValue(tags)
+	}
+	return results, nil
+}
+
+//	key "path": Return value in consul KVS, or undefined when key doesn't exist
+func keyTemplateFunction(vars map[string]string, args []string) (interface{}, error) {
+	kv, _, err := Consul().KV().Get(args[0], &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, nil
+	}
+	return string(kv.Value), nil
+}
+
+//	keyOrDefault "path" "default": Return value in consul KVS, or default when key doesn't exist
+func keyOrDefaultTemplateFunction(vars map[string]string, args []string) (interface{}, error) {
+	v, err := keyTemplateFunction(vars, args[:1])
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return args[1], nil
+	}
+	return v, nil
+}
+
+//	ls "prefix": Return keys and values just under prefix in consul KVS
+//	ex. {"mode": "primary", "port": "5432"}
+func lsTemplateFunction(vars map[string]string, args []string) (interface{}, error) {
+	prefix := args[0]
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	kvs, _, err := Consul().KV().List(prefix, &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]interface{})
+	for _, kv := range kvs {
+		k := strings.TrimPrefix(kv.Key, prefix)
+		if k == "" || strings.Contains(k, "/") {
+			continue
+		}
+		results[k] = string(kv.Value)
+	}
+	return results, nil
+}
+
+//	node "name": Return node in consul catalog with its services, self node is used when name is omitted
+//	ex. {"name": "db1", "address": "10.0.0.1", "services": [{"id": "postgresql", "service": "postgresql", ...}]}
+func nodeTemplateFunction(vars map[string]string, args []string) (interface{}, error) {
+	var name string
+	if len(args) == 1 {
+		name = args[0]
+	} else {
+		var err error
+		if name, err = Consul().Agent().NodeName(); err != nil {
+			return nil, err
+		}
+	}
+	c, _, err := Consul().Catalog().Node(name, &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.Node == nil {
+		return nil, nil
+	}
+
+	var ids []string
+	for id := range c.Services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	services := make([]interface{}, 0)
+	for _, id := range ids {
+		s := c.Services[id]
+		services = append(services, map[string]interface{}{
+			"id":      s.ID,
+			"service": s.Service,
+			"address": s.Address,
+			"port":    float64(s.Port),
+			"tags":    stringsValue(s.Tags),
+		})
+	}
+	return map[string]interface{}{
+		"name":     c.Node.Node,
+		"address":  c.Node.Address,
+		"services": services,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package util
+
+import (
+	"metronome/config"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	vars := map[string]string{
+		"name":    "web",
+		"mode":    "primary",
+		"empty":   "",
+		"message": "it's ok",
+		"json":    `{"members": [{"name": "db1"}, {"name": "db2"}]}`,
+		"ref":     "{{name}}-{{mode}}",
+		"nested":  "[{{ref}}]",
+	}
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"{{name}}", "web"},
+		{"{{ name }}:{{mode}}", "web:primary"},
+		{"{{nested}}", "[web-primary]"},
+		{"{{undefined}}", "{{undefined}}"},
+		{"{{foo bar}}", "{{foo bar}}"},
+		{`\{{name}}`, "{{name}}"},
+		{`{{"literal"}}`, "literal"},
+		{`{{empty | default "x"}}`, "x"},
+		{`{{undefined | default "x"}}`, "x"},
+		{`{{name | default "x"}}`, "web"},
+		{"{{name | upper}}", "WEB"},
+		{`{{name | upper | lower}}`, "web"},
+		{`{{" a " | trim}}`, "a"},
+		{`{{mode | replace "primary" "standby"}}`, "standby"},
+		{"{{message | quote}}", `'it'\''s ok'`},
+		{"{{message | json}}", `"it's ok"`},
+		{`{{json | jsonpath "members.1.name"}}`, "db2"},
+		{`{{json | jsonpath "members.0"}}`, `{"name":"db1"}`},
+		{`{{json | jsonpath "members.5.name"}}`, `{{json | jsonpath "members.5.name"}}`},
+		{`{{if mode == "primary"}}P{{else}}S{{end}}`, "P"},
+		{`{{if mode == "standby"}}S{{else if name == "web"}}W{{else}}X{{end}}`, "W"},
+		{`{{if undefined}}A{{else}}B{{end}}`, "B"},
+		{`{{if ref == "web-primary"}}{{name}}{{end}}`, "web"},
+		{`{{echo name}}`, "echo:web"},
+		{`{{echo "x" | upper}}`, "ECHO:X"},
+		{`{{echo undefined}}`, `{{echo undefined}}`},
+		{`{{list}}`, `["a","b"]`},
+	}
+
+	templateFunctions["echo"] = templateFunction{1, 1, func(vars map[string]string, args []string) (interface{}, error) {
+		return "echo:" + args[0], nil
+	}}
+	templateFunctions["list"] = templateFunction{0, 0, func(vars map[string]string, args []string) (interface{}, error) {
+		return []interface{}{"a", "b"}, nil
+	}}
+	defer delete(templateFunctions, "echo")
+	defer delete(templateFunctions, "list")
+
+	for _, c := range cases {
+		actual, err := Render(c.src, vars)
+		if err != nil {
+			t.Errorf("Render(%q) returns error: %s", c.src, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("Render(%q) = %q, want %q", c.src, actual, c.expected)
+		}
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	vars := map[string]string{"a": "{{b}}", "b": "{{a}}", "self": "{{self}}", "json": "not json"}
+	cases := []struct {
+		src    string
+		strict bool
+	}{
+		{"{{a}}", false},
+		{"{{self}}", false},
+		{"{{if a}}", false},
+		{"{{if}}x{{end}}", false},
+		{"{{end}}", false},
+		{"{{else}}", false},
+		{`{{json | jsonpath "a"}}`, false},
+		{"{{undefined}}", true},
+		{"{{foo bar}}", true},
+	}
+	defer func() { config.StrictVariables = false }()
+	for _, c := range cases {
+		config.StrictVariables = c.strict
+		if actual, err := Render(c.src, vars); err == nil {
+			t.Errorf("Render(%q) = %q, want error", c.src, actual)
+		}
+	}
+}
+
+func TestRenderEscaped(t *testing.T) {
+	vars := map[string]string{"quote": `say "hi"`, "ref": "{{quote}}!"}
+	escape := func(s string) string { return "<" + s + ">" }
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{`{"a": "{{quote}}"}`, `{"a": "<say "hi">"}`},
+		{`{{ref}}`, `<say "hi"!>`},
+		{`{{if quote}}{{ref}}{{end}}`, `<say "hi"!>`},
+		{`{{undefined}}`, `<{{undefined}}>`},
+	}
+	for _, c := range cases {
+		actual, err := RenderEscaped(c.src, vars, escape)
+		if err != nil {
+			t.Errorf("RenderEscaped(%q) returns error: %s", c.src, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("RenderEscaped(%q) = %q, want %q", c.src, actual, c.expected)
+		}
+	}
+}
+
+func TestTemplateVariables(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected []string
+	}{
+		{"text", nil},
+		{"{{a}} and {{b | upper}}", []string{"a", "b"}},
+		{`{{a | default "x"}}`, nil},
+		{`{{a | replace b "x"}}`, []string{"b", "a"}},
+		{"{{config.role}}", nil},
+		{`{{key path}}`, []string{"path"}},
+		{`{{if c}}{{d}}{{else}}{{e}}{{end}}`, []string{"d", "e"}},
+	}
+	for _, c := range cases {
+		actual, err := TemplateVariables(c.src)
+		if err != nil {
+			t.Errorf("TemplateVariables(%q) returns error: %s", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("TemplateVariables(%q) = %v, want %v", c.src, actual, c.expected)
+		}
+	}
+}
+
+func TestJSONPathFilter(t *testing.T) {
+	value := map[string]interface{}{
+		"a": []interface{}{float64(1), map[string]interface{}{"b": "c"}},
+	}
+	cases := []struct {
+		src      interface{}
+		path     string
+		expected interface{}
+	}{
+		{value, "a.1.b", "c"},
+		{value, "a.0", float64(1)},
+		{value, "", value},
+		{value, "a.2", nil},
+		{value, "a.-1", nil},
+		{value, "a.x", nil},
+		{value, "x.y", nil},
+		{`{"a": [true]}`, "a.0", true},
+		{`[1, 2]`, "1", float64(2)},
+	}
+	for _, c := range cases {
+		actual, err := jsonPathFilter(c.src, []string{c.path})
+		if err != nil {
+			t.Errorf("jsonpath %q returns error: %s", c.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("jsonpath %q of %v = %#v, want %#v", c.path, c.src, actual, c.expected)
+		}
+	}
+}
+
+func TestRenderLiteral(t *testing.T) {
+	vars := map[string]string{
+		"param":  Literal(`{{key "secret/path"}}`),
+		"nested": Literal(`\{{param}}`),
+		"ref":    "{{param}}",
+	}
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{"{{param}}", `{{key "secret/path"}}`},
+		{"{{ref}}", `{{key "secret/path"}}`},
+		{"{{nested}}", `\{{param}}`},
+		{"{{param | upper}}", `{{KEY "SECRET/PATH"}}`},
+		{`{{if param == "{{key \"secret/path\"}}"}}match{{end}}`, "match"},
+	}
+	for _, c := range cases {
+		actual, err := Render(c.src, vars)
+		if err != nil {
+			t.Errorf("Render(%q) returns error: %s", c.src, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("Render(%q) = %q, want %q", c.src, actual, c.expected)
+		}
+	}
+
+	if ok, err := Evaluate(`param == "{{key \"secret/path\"}}"`, vars); err != nil || !ok {
+		t.Errorf("Evaluate doesn't compare literal as it is(%v, %v)", ok, err)
+	}
+}
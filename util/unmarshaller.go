@@ -1,6 +1,10 @@
 package util
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
 
 type UnmarshalContext struct {
 	Err error
@@ -13,3 +17,36 @@ func (u *UnmarshalContext) Unmarshal(data []byte, v interface{}) error {
 	u.Err = json.Unmarshal(data, v)
 	return u.Err
 }
+
+//	Convert scalar value in task.yml to string(ex. 5432 -> "5432"), false when it isn't scalar
+func ScalarString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64, bool:
+		return fmt.Sprint(v), true
+	case nil:
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+//	Map of string that also accepts number and boolean as value
+type StringMap map[string]string
+
+func (m *StringMap) UnmarshalJSON(d []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(d, &raw); err != nil {
+		return err
+	}
+	*m = make(StringMap)
+	for k, v := range raw {
+		s, ok := ScalarString(v)
+		if !ok {
+			return errors.New(fmt.Sprintf("%s must be scalar value", k))
+		}
+		(*m)[k] = s
+	}
+	return nil
+}
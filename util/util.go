@@ -1,9 +1,23 @@
 package util
 
-import "os"
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
 
 //	Return true when specified path is exist
 func Exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
+
+//	Return exit status of command from error, or zero when error isn't caused by exit status
+func ExitCode(err error) int {
+	if e, ok := err.(*exec.ExitError); ok {
+		if s, ok := e.Sys().(syscall.WaitStatus); ok {
+			return s.ExitStatus()
+		}
+	}
+	return 0
+}